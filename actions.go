@@ -1,7 +1,8 @@
 package main
 
 import (
-	"github.com/gdamore/tcell/v2"
+	"errors"
+
 	"github.com/rivo/tview"
 	"libvirt.org/go/libvirt"
 )
@@ -24,16 +25,62 @@ func (m Message) FailMessage() string {
 	return m.actionFail
 }
 
+// Meta describes an action for the help and how it is to be handled before
+// it runs.
+type Meta struct {
+	// label is the short name shown next to the key
+	label string
+	// description is the longer explanation shown in the help page
+	description string
+	// dangerous actions are confirmed before they run
+	dangerous bool
+	// states the action applies to, nil means every state
+	states []libvirt.DomainState
+}
+
+func (m Meta) Label() string {
+	return m.label
+}
+
+func (m Meta) Description() string {
+	return m.description
+}
+
+func (m Meta) Dangerous() bool {
+	return m.dangerous
+}
+
+// ValidIn returns whether the action applies to a domain in the state.
+func (m Meta) ValidIn(state libvirt.DomainState) bool {
+	if m.states == nil {
+		return true
+	}
+	for _, valid := range m.states {
+		if valid == state {
+			return true
+		}
+	}
+	return false
+}
+
+// runningStates are the states in which the guest is executing.
+var runningStates = []libvirt.DomainState{libvirt.DOMAIN_RUNNING, libvirt.DOMAIN_BLOCKED}
+
 type Action interface {
 	Execute(dom *libvirt.Domain) error
 	StartMessage() string
 	SuccessMessage() string
 	FailMessage() string
+	Label() string
+	Description() string
+	Dangerous() bool
+	ValidIn(state libvirt.DomainState) bool
 }
 
 type SimpleAction struct {
 	actionFunc func(dom *libvirt.Domain) error
 	Message
+	Meta
 }
 
 func (a SimpleAction) Execute(dom *libvirt.Domain) error {
@@ -42,32 +89,139 @@ func (a SimpleAction) Execute(dom *libvirt.Domain) error {
 
 type UIAction struct {
 	Message
+	Meta
 	actionFunc func(dom *libvirt.Domain, app *tview.Application, pages *tview.Pages) error
-	app        *tview.Application
-	pages      *tview.Pages
+	// argsFunc does the same as the form, with the input given as command
+	// palette arguments
+	argsFunc func(dom *libvirt.Domain, args []string) error
+	app      *tview.Application
+	pages    *tview.Pages
 }
 
 func (a UIAction) Execute(dom *libvirt.Domain) error {
 	return a.actionFunc(dom, a.app, a.pages)
 }
 
-func NewSimpleAction(start, success, fail string, actionFunc func(*libvirt.Domain) error) SimpleAction {
-	return SimpleAction{Message: Message{start, success, fail}, actionFunc: actionFunc}
+func (a UIAction) withArgsFunc(argsFunc func(*libvirt.Domain, []string) error) UIAction {
+	a.argsFunc = argsFunc
+	return a
+}
+
+// WithArgs returns an action that runs without the form, using args as its
+// input.
+func (a UIAction) WithArgs(args []string) (Action, error) {
+	if a.argsFunc == nil {
+		return nil, errors.New("takes no arguments")
+	}
+	return SimpleAction{Message: a.Message, Meta: a.Meta, actionFunc: func(dom *libvirt.Domain) error {
+		return a.argsFunc(dom, args)
+	}}, nil
+}
+
+// ArgsAction is an action that can take its input as command palette
+// arguments.
+type ArgsAction interface {
+	Action
+	WithArgs(args []string) (Action, error)
+}
+
+func NewSimpleAction(meta Meta, start, success, fail string, actionFunc func(*libvirt.Domain) error) SimpleAction {
+	return SimpleAction{Message: Message{start, success, fail}, Meta: meta, actionFunc: actionFunc}
+}
+
+func NewUIAction(meta Meta, start, success, fail string, actionFunc func(*libvirt.Domain, *tview.Application, *tview.Pages) error, app *tview.Application, pages *tview.Pages) UIAction {
+	return UIAction{Message: Message{start, success, fail}, Meta: meta, actionFunc: actionFunc, app: app, pages: pages}
+}
+
+// actionOrder is the order in which actions are listed in the help.
+var actionOrder = []string{
+	"start", "shutdown", "resume", "suspend", "reboot", "destroy",
+	"attach-disk", "detach-disk", "attach-nic", "detach-nic", "undefine", "shutdown-timeout",
+	"snapshots",
 }
 
-func NewUIAction(start, success, fail string, actionFunc func(*libvirt.Domain, *tview.Application, *tview.Pages) error, app *tview.Application, pages *tview.Pages) UIAction {
-	return UIAction{Message: Message{start, success, fail}, actionFunc: actionFunc, app: app, pages: pages}
+func newDestroyAction() SimpleAction {
+	return NewSimpleAction(Meta{
+		label:       "Destroy",
+		description: "Power off the VM immediately, like pulling the plug",
+		dangerous:   true,
+		states: []libvirt.DomainState{
+			libvirt.DOMAIN_RUNNING, libvirt.DOMAIN_BLOCKED, libvirt.DOMAIN_PAUSED,
+			libvirt.DOMAIN_SHUTDOWN, libvirt.DOMAIN_PMSUSPENDED, libvirt.DOMAIN_CRASHED,
+		},
+	}, "Destroying", "destroyed", "Failed to destroy", (*libvirt.Domain).Destroy)
 }
 
-func initActions(app *tview.Application, pages *tview.Pages) map[tcell.Key]Action {
-	return map[tcell.Key]Action{
-		tcell.KeyCtrlQ: NewSimpleAction("Starting", "started", "Failed to start", (*libvirt.Domain).Create),
-		tcell.KeyCtrlA: NewSimpleAction("Stopping", "stopped", "Failed to stop", (*libvirt.Domain).Shutdown),
-		tcell.KeyCtrlW: NewSimpleAction("Resuming", "resumed", "Failed to resume", (*libvirt.Domain).Resume),
-		tcell.KeyCtrlS: NewSimpleAction("Suspending", "suspended", "Failed to suspend", (*libvirt.Domain).Suspend),
-		tcell.KeyCtrlE: NewSimpleAction("Rebooting", "rebooted", "Failed to reboot", func(d *libvirt.Domain) error { return d.Reboot(0) }),
-		tcell.KeyCtrlD: NewSimpleAction("Destroying", "destroyed", "Failed to destroy", (*libvirt.Domain).Destroy),
-		tcell.KeyCtrlR: NewUIAction("Attaching disk to", "attached disk to", "Failed to attach disk to", attachDisk, app, pages),
-		tcell.KeyCtrlF: NewUIAction("Detaching disk from", "detached disk from", "Failed to detach disk from", detachDisk, app, pages),
+// initActions returns every action by its ID, the IDs are what keys are
+// bound to in the config.
+func initActions(app *tview.Application, pages *tview.Pages, jobs *jobQueue) map[string]Action {
+	return map[string]Action{
+		"start": NewSimpleAction(Meta{
+			label:       "Start",
+			description: "Boot the VM",
+			states:      []libvirt.DomainState{libvirt.DOMAIN_SHUTOFF, libvirt.DOMAIN_CRASHED},
+		}, "Starting", "started", "Failed to start", (*libvirt.Domain).Create),
+		"shutdown": NewSimpleAction(Meta{
+			label:       "Stop",
+			description: "Ask the guest OS to shut down",
+			states:      runningStates,
+		}, "Stopping", "stopped", "Failed to stop", (*libvirt.Domain).Shutdown),
+		"resume": NewSimpleAction(Meta{
+			label:       "Resume",
+			description: "Continue a suspended VM",
+			states:      []libvirt.DomainState{libvirt.DOMAIN_PAUSED},
+		}, "Resuming", "resumed", "Failed to resume", (*libvirt.Domain).Resume),
+		"suspend": NewSimpleAction(Meta{
+			label:       "Suspend",
+			description: "Pause the VM's CPUs, its memory stays allocated",
+			states:      runningStates,
+		}, "Suspending", "suspended", "Failed to suspend", (*libvirt.Domain).Suspend),
+		"reboot": NewSimpleAction(Meta{
+			label:       "Reboot",
+			description: "Ask the guest OS to reboot",
+			dangerous:   true,
+			states:      runningStates,
+		}, "Rebooting", "rebooted", "Failed to reboot", func(d *libvirt.Domain) error { return d.Reboot(0) }),
+		"destroy": newDestroyAction(),
+		"undefine": NewSimpleAction(Meta{
+			label:       "Undefine",
+			description: "Remove the VM's configuration, a running VM keeps running until it stops",
+			dangerous:   true,
+		}, "Undefining", "undefined", "Failed to undefine", func(d *libvirt.Domain) error { return d.UndefineFlags(libvirt.DOMAIN_UNDEFINE_NVRAM) }),
+		"shutdown-timeout": NewSimpleAction(Meta{
+			label:       "Shutdown/timeout",
+			description: "Shut down through ACPI, then the guest agent, then destroy after the timeout",
+			states:      runningStates,
+		}, "Shutting down", "shut down", "Failed to shut down", func(d *libvirt.Domain) error { return shutdownWithTimeout(d, app, pages, jobs) }),
+		"attach-disk": NewUIAction(Meta{
+			label:       "Attach disk",
+			description: "Attach a disk, cdrom or LUN, args: <path> [target dev] [--format=raw|qcow2] [--live] [--config]",
+		}, "Attaching disk to", "attached disk to", "Failed to attach disk to", func(d *libvirt.Domain, app *tview.Application, pages *tview.Pages) error {
+			return attachDisk(d, app, pages, jobs)
+		}, app, pages).withArgsFunc(attachDiskArgs),
+		"detach-disk": NewUIAction(Meta{
+			label:       "Detach disk",
+			description: "Unplug a disk, args: <target dev> [--live] [--config]",
+		}, "Detaching disk from", "detached disk from", "Failed to detach disk from", func(d *libvirt.Domain, app *tview.Application, pages *tview.Pages) error {
+			return detachDisk(d, pages, jobs)
+		}, app, pages).withArgsFunc(detachDiskArgs),
+		"attach-nic": NewUIAction(Meta{
+			label:       "Attach NIC",
+			description: "Plug in a network interface, args: <network|bridge> <source> [model] [mac] [--live] [--config]",
+		}, "Attaching interface to", "attached interface to", "Failed to attach interface to", func(d *libvirt.Domain, app *tview.Application, pages *tview.Pages) error {
+			return attachNIC(d, pages, jobs)
+		}, app, pages).withArgsFunc(attachNICArgs),
+		"detach-nic": NewUIAction(Meta{
+			label:       "Detach NIC",
+			description: "Unplug a network interface, args: <mac> [--live] [--config]",
+		}, "Detaching interface from", "detached interface from", "Failed to detach interface from", func(d *libvirt.Domain, app *tview.Application, pages *tview.Pages) error {
+			return detachNIC(d, pages, jobs)
+		}, app, pages).withArgsFunc(detachNICArgs),
+		"snapshots": NewUIAction(Meta{
+			label:       "Snapshots",
+			description: "List, create, revert to and delete snapshots",
+		}, "Showing snapshots of", "showed snapshots of", "Failed to show snapshots of", func(d *libvirt.Domain, app *tview.Application, pages *tview.Pages) error {
+			return showSnapshots(d, app, pages, jobs)
+		}, app, pages),
 	}
 }
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"libvirt.org/go/libvirt"
+)
+
+type vcpuStat struct {
+	index int
+	state libvirt.VcpuState
+	time  uint64
+	usage float64
+}
+
+type blockStat struct {
+	name    string
+	path    string
+	rdBytes uint64
+	wrBytes uint64
+	rdBps   float64
+	wrBps   float64
+	rdIops  float64
+	wrIops  float64
+}
+
+type netStat struct {
+	name    string
+	rxBytes uint64
+	txBytes uint64
+	rxPkts  uint64
+	txPkts  uint64
+	rxErrs  uint64
+	txErrs  uint64
+	rxDrop  uint64
+	txDrop  uint64
+	rxBps   float64
+	txBps   float64
+}
+
+// breakdown holds the latest per-vCPU, per-block-device and per-interface
+// statistics of a domain.
+type breakdown struct {
+	vcpus  []vcpuStat
+	blocks []blockStat
+	nets   []netStat
+}
+
+type blockSamples struct {
+	rdBytes, wrBytes, rdReqs, wrReqs counterSample
+}
+
+type netSamples struct {
+	rxBytes, txBytes counterSample
+}
+
+// deviceSamples are the previous per-device counters, keyed by vCPU index
+// and device name.
+type deviceSamples struct {
+	vcpus  map[int]*counterSample
+	blocks map[string]*blockSamples
+	nets   map[string]*netSamples
+}
+
+func newDeviceSamples() *deviceSamples {
+	return &deviceSamples{
+		vcpus:  make(map[int]*counterSample),
+		blocks: make(map[string]*blockSamples),
+		nets:   make(map[string]*netSamples),
+	}
+}
+
+// updateBreakdown computes the per-device statistics from the record.
+func (sp *StatProvider) updateBreakdown(stats *libvirt.DomainStats, at time.Time) {
+	if sp.prevSt.devices == nil {
+		sp.prevSt.devices = newDeviceSamples()
+	}
+	prev := sp.prevSt.devices
+	var bd breakdown
+
+	for i, vcpu := range stats.Vcpu {
+		sample, ok := prev.vcpus[i]
+		if !ok {
+			sample = &counterSample{}
+			prev.vcpus[i] = sample
+		}
+		nsPerSecond, _ := sample.rate(vcpu.Time, at)
+		bd.vcpus = append(bd.vcpus, vcpuStat{index: i, state: vcpu.State, time: vcpu.Time, usage: nsPerSecond / 1e9 * 100})
+	}
+
+	for _, block := range stats.Block {
+		samples, ok := prev.blocks[block.Name]
+		if !ok {
+			samples = &blockSamples{}
+			prev.blocks[block.Name] = samples
+		}
+		stat := blockStat{name: block.Name, path: block.Path, rdBytes: block.RdBytes, wrBytes: block.WrBytes}
+		stat.rdBps, _ = samples.rdBytes.rate(block.RdBytes, at)
+		stat.wrBps, _ = samples.wrBytes.rate(block.WrBytes, at)
+		stat.rdIops, _ = samples.rdReqs.rate(block.RdReqs, at)
+		stat.wrIops, _ = samples.wrReqs.rate(block.WrReqs, at)
+		bd.blocks = append(bd.blocks, stat)
+	}
+
+	for _, iface := range stats.Net {
+		samples, ok := prev.nets[iface.Name]
+		if !ok {
+			samples = &netSamples{}
+			prev.nets[iface.Name] = samples
+		}
+		stat := netStat{
+			name:    iface.Name,
+			rxBytes: iface.RxBytes, txBytes: iface.TxBytes,
+			rxPkts: iface.RxPkts, txPkts: iface.TxPkts,
+			rxErrs: iface.RxErrs, txErrs: iface.TxErrs,
+			rxDrop: iface.RxDrop, txDrop: iface.TxDrop,
+		}
+		stat.rxBps, _ = samples.rxBytes.rate(iface.RxBytes, at)
+		stat.txBps, _ = samples.txBytes.rate(iface.TxBytes, at)
+		bd.nets = append(bd.nets, stat)
+	}
+
+	prev.prune(stats)
+
+	sp.mu.Lock()
+	sp.latest = bd
+	sp.mu.Unlock()
+}
+
+// prune drops the samples of vCPUs and devices missing from the record, so an
+// unplugged device doesn't linger and one plugged in later under the same
+// name starts from a fresh baseline.
+func (prev *deviceSamples) prune(stats *libvirt.DomainStats) {
+	for i := range prev.vcpus {
+		if i >= len(stats.Vcpu) {
+			delete(prev.vcpus, i)
+		}
+	}
+	blocks := make(map[string]bool, len(stats.Block))
+	for _, block := range stats.Block {
+		blocks[block.Name] = true
+	}
+	for name := range prev.blocks {
+		if !blocks[name] {
+			delete(prev.blocks, name)
+		}
+	}
+	nets := make(map[string]bool, len(stats.Net))
+	for _, iface := range stats.Net {
+		nets[iface.Name] = true
+	}
+	for name := range prev.nets {
+		if !nets[name] {
+			delete(prev.nets, name)
+		}
+	}
+}
+
+// breakdown returns the latest per-device statistics, safe to use from any
+// goroutine.
+func (sp *StatProvider) breakdown() breakdown {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	return breakdown{
+		vcpus:  append([]vcpuStat(nil), sp.latest.vcpus...),
+		blocks: append([]blockStat(nil), sp.latest.blocks...),
+		nets:   append([]netStat(nil), sp.latest.nets...),
+	}
+}
+
+func (bd breakdown) String() string {
+	var builder strings.Builder
+	builder.WriteString("vCPU  Time          Usage\n")
+	for _, vcpu := range bd.vcpus {
+		if vcpu.state == libvirt.VCPU_OFFLINE {
+			fmt.Fprintf(&builder, "%-5d offline\n", vcpu.index)
+			continue
+		}
+		cpuTime := (time.Duration(vcpu.time) * time.Nanosecond).Truncate(time.Second)
+		fmt.Fprintf(&builder, "%-5d %-13s %.2f%%\n", vcpu.index, cpuTime, vcpu.usage)
+	}
+
+	builder.WriteString("\nDisk    Read/s     Write/s    rIOPS   wIOPS   Read       Written\n")
+	for _, block := range bd.blocks {
+		fmt.Fprintf(&builder, "%-7s %-10s %-10s %-7.0f %-7.0f %-10s %s\n", block.name,
+			humanize.IBytes(uint64(block.rdBps)), humanize.IBytes(uint64(block.wrBps)),
+			block.rdIops, block.wrIops,
+			humanize.IBytes(block.rdBytes), humanize.IBytes(block.wrBytes))
+	}
+
+	builder.WriteString("\nNIC        Rx/s       Tx/s       Rx         Tx         Pkts rx/tx      Errs rx/tx  Drop rx/tx\n")
+	for _, iface := range bd.nets {
+		fmt.Fprintf(&builder, "%-10s %-10s %-10s %-10s %-10s %-15s %-11s %s\n", iface.name,
+			humanize.IBytes(uint64(iface.rxBps)), humanize.IBytes(uint64(iface.txBps)),
+			humanize.IBytes(iface.rxBytes), humanize.IBytes(iface.txBytes),
+			fmt.Sprintf("%d/%d", iface.rxPkts, iface.txPkts),
+			fmt.Sprintf("%d/%d", iface.rxErrs, iface.txErrs),
+			fmt.Sprintf("%d/%d", iface.rxDrop, iface.txDrop))
+	}
+	return builder.String()
+}
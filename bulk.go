@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+type bulkResult struct {
+	name string
+	err  error
+	// skipped results didn't run because the domain was in the wrong state
+	skipped bool
+}
+
+// lastBulkResults holds the outcome of the last bulk action for the results
+// page. Only accessed from the UI goroutine.
+var lastBulkResults []bulkResult
+var lastBulkAction string
+
+// runBulkAction queues the action for every target and summarizes the
+// results once all of them finished, listing the skipped domains first. The
+// queue takes ownership of the targets' domains.
+func runBulkAction(jobs *jobQueue, action Action, targets []domainEntry, skipped []bulkResult) {
+	setStatus(fmt.Sprintf("%s %d VMs", action.StartMessage(), len(targets)))
+
+	results := make([]bulkResult, len(skipped)+len(targets))
+	copy(results, skipped)
+	pending := len(targets)
+	for i, target := range targets {
+		jobs.submit(action, target.dom, target.name, func(err error) {
+			results[len(skipped)+i] = bulkResult{name: target.name, err: err}
+			pending--
+			if pending > 0 {
+				return
+			}
+
+			failed := 0
+			for _, result := range results {
+				if result.err != nil && !result.skipped {
+					failed++
+				}
+			}
+			lastBulkResults = results
+			lastBulkAction = action.StartMessage()
+			summary := fmt.Sprintf("Successfully %s %d of %d VMs", action.SuccessMessage(), len(results)-failed-len(skipped), len(results))
+			if failed > 0 {
+				summary += fmt.Sprintf(", %d failed", failed)
+			}
+			if len(skipped) > 0 {
+				summary += fmt.Sprintf(", %d skipped", len(skipped))
+			}
+			setStatus(summary + " (r: results)")
+		})
+	}
+}
+
+func createBulkResultsView(pages *tview.Pages) *tview.Grid {
+	var builder strings.Builder
+	for _, result := range lastBulkResults {
+		if result.skipped {
+			fmt.Fprintf(&builder, "%-30s skipped: %s\n", result.name, result.err)
+		} else if result.err != nil {
+			fmt.Fprintf(&builder, "%-30s failed: %s\n", result.name, libvirtError(result.err))
+		} else {
+			fmt.Fprintf(&builder, "%-30s ok\n", result.name)
+		}
+	}
+	resultsView := transparentTextView(builder.String())
+	resultsView.SetBorder(true).SetTitle("Results: " + lastBulkAction).SetTitleAlign(tview.AlignLeft)
+
+	resultsGrid := tview.NewGrid().
+		SetRows(0, 1).
+		SetColumns(0).
+		SetBorders(false).
+		AddItem(resultsView, 0, 0, 1, 1, 0, 0, true).
+		AddItem(statusView, 1, 0, 1, 1, 0, 0, false)
+	resultsGrid.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if event.Key() == tcell.KeyEscape || event.Rune() == 'q' {
+			pages.SwitchToPage("MainTable")
+			pages.RemovePage("BulkResults")
+			return nil
+		}
+		return event
+	})
+	return resultsGrid
+}
+
+func showBulkResults(pages *tview.Pages) {
+	if lastBulkResults == nil {
+		setStatus("No bulk action has been run yet")
+		return
+	}
+	pages.AddPage("BulkResults", createBulkResultsView(pages), true, false)
+	pages.SwitchToPage("BulkResults")
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/BurntSushi/toml"
+	"github.com/gdamore/tcell/v2"
+)
+
+// Config is read from config.toml, e.g.
+//
+//	[keys]
+//	"F2" = "start"
+//	"Ctrl-G" = ""        # unbind
+//	"Alt-s" = "suspend"
+//
+//	[confirm]
+//	type_name = true
+//	disabled = ["reboot"]
+type Config struct {
+	// Keys maps key names to action IDs. An action bound here loses its
+	// default key, an empty action ID unbinds the key.
+	Keys    map[string]string `toml:"keys"`
+	Confirm struct {
+		TypeName bool     `toml:"type_name"`
+		Disabled []string `toml:"disabled"`
+	} `toml:"confirm"`
+}
+
+// keyBinding is a key as matched against key events. Printable characters
+// are stored as KeyRune with the rune, everything else by its key. mod holds
+// the modifiers beyond those the key implies: Shift is in the case of a rune
+// and Ctrl in the name of a control key, e.g. Ctrl-G.
+type keyBinding struct {
+	key tcell.Key
+	r   rune
+	mod tcell.ModMask
+}
+
+func bindingOf(event *tcell.EventKey) keyBinding {
+	mod := event.Modifiers()
+	if event.Key() == tcell.KeyRune {
+		return keyBinding{key: tcell.KeyRune, r: event.Rune(), mod: mod &^ tcell.ModShift}
+	}
+	if strings.HasPrefix(tcell.KeyNames[event.Key()], "Ctrl-") {
+		mod &^= tcell.ModCtrl
+	}
+	return keyBinding{key: event.Key(), mod: mod}
+}
+
+// keyModifiers are the modifier prefixes parseKey accepts.
+var keyModifiers = []struct {
+	prefix string
+	mod    tcell.ModMask
+}{
+	{"Alt-", tcell.ModAlt},
+	{"Shift-", tcell.ModShift},
+}
+
+// parseKey accepts tcell key names ("Ctrl-G", "F5", "Delete") and single
+// characters, optionally prefixed with Alt- or Shift-, e.g. "Alt-s".
+func parseKey(name string) (keyBinding, error) {
+	var mod tcell.ModMask
+	for found := true; found; {
+		found = false
+		for _, m := range keyModifiers {
+			if len(name) > len(m.prefix) && strings.EqualFold(name[:len(m.prefix)], m.prefix) {
+				mod |= m.mod
+				name = name[len(m.prefix):]
+				found = true
+			}
+		}
+	}
+	if utf8.RuneCountInString(name) == 1 {
+		r, _ := utf8.DecodeRuneInString(name)
+		// Shift is in the case of the rune, as in key events
+		if mod&tcell.ModShift != 0 {
+			r = unicode.ToUpper(r)
+		}
+		return keyBinding{key: tcell.KeyRune, r: r, mod: mod &^ tcell.ModShift}, nil
+	}
+	for key, keyName := range tcell.KeyNames {
+		if strings.EqualFold(keyName, name) {
+			return keyBinding{key: key, mod: mod}, nil
+		}
+	}
+	return keyBinding{}, fmt.Errorf("unknown key %q", name)
+}
+
+// String returns the short form of the key shown in the help, e.g. ^G or
+// Alt-s.
+func (b keyBinding) String() string {
+	var prefix string
+	for _, m := range keyModifiers {
+		if b.mod&m.mod != 0 {
+			prefix += m.prefix
+		}
+	}
+	if b.key == tcell.KeyRune {
+		return prefix + string(b.r)
+	}
+	name := tcell.KeyNames[b.key]
+	if strings.HasPrefix(name, "Ctrl-") {
+		return prefix + "^" + strings.TrimPrefix(name, "Ctrl-")
+	}
+	return prefix + name
+}
+
+// defaultKeys are the key bindings used unless the config changes them.
+// Ctrl-Q and Ctrl-S are left alone, terminals use them for flow control.
+var defaultKeys = map[string]string{
+	"Ctrl-G": "start",
+	"Ctrl-A": "shutdown",
+	"Ctrl-W": "resume",
+	"Ctrl-X": "suspend",
+	"Ctrl-E": "reboot",
+	"Ctrl-D": "destroy",
+	"Ctrl-U": "undefine",
+	"Ctrl-T": "shutdown-timeout",
+	"Ctrl-R": "attach-disk",
+	"Ctrl-F": "detach-disk",
+	"Ctrl-O": "attach-nic",
+	"Ctrl-P": "detach-nic",
+	"Ctrl-N": "snapshots",
+}
+
+func defaultConfigPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "config.toml"
+	}
+	return filepath.Join(dir, "virt-man-tui", "config.toml")
+}
+
+// loadConfig reads the config file, a missing file results in an empty config.
+func loadConfig(path string) (Config, error) {
+	var config Config
+	if _, err := toml.DecodeFile(path, &config); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return Config{}, fmt.Errorf("failed to read config %s: %w", path, err)
+	}
+	return config, nil
+}
+
+// keyBindings merges the configured keys into the defaults and checks that
+// every bound action exists.
+func (c Config) keyBindings(actions map[string]Action) (map[keyBinding]string, error) {
+	rebound := make(map[string]bool)
+	for _, id := range c.Keys {
+		rebound[id] = true
+	}
+
+	bindings := make(map[keyBinding]string)
+	for name, id := range defaultKeys {
+		if rebound[id] {
+			continue
+		}
+		key, err := parseKey(name)
+		if err != nil {
+			return nil, err
+		}
+		bindings[key] = id
+	}
+	for name, id := range c.Keys {
+		key, err := parseKey(name)
+		if err != nil {
+			return nil, err
+		}
+		if id == "" {
+			delete(bindings, key)
+			continue
+		}
+		if _, ok := actions[id]; !ok {
+			return nil, fmt.Errorf("key %s is bound to unknown action %q", name, id)
+		}
+		bindings[key] = id
+	}
+	return bindings, nil
+}
+
+// checkActionIDs makes sure every ID names an action.
+func checkActionIDs(ids []string, actions map[string]Action) error {
+	for _, id := range ids {
+		if _, ok := actions[id]; !ok {
+			return fmt.Errorf("unknown action %q", id)
+		}
+	}
+	return nil
+}
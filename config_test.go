@@ -0,0 +1,63 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+func TestParseKeyMatchesEvents(t *testing.T) {
+	tests := []struct {
+		name  string
+		event *tcell.EventKey
+	}{
+		{"s", tcell.NewEventKey(tcell.KeyRune, 's', tcell.ModNone)},
+		{"S", tcell.NewEventKey(tcell.KeyRune, 'S', tcell.ModShift)},
+		{"Shift-s", tcell.NewEventKey(tcell.KeyRune, 'S', tcell.ModShift)},
+		{"Alt-s", tcell.NewEventKey(tcell.KeyRune, 's', tcell.ModAlt)},
+		{"Alt-Shift-s", tcell.NewEventKey(tcell.KeyRune, 'S', tcell.ModAlt|tcell.ModShift)},
+		{"Ctrl-G", tcell.NewEventKey(tcell.KeyCtrlG, 0, tcell.ModCtrl)},
+		{"F5", tcell.NewEventKey(tcell.KeyF5, 0, tcell.ModNone)},
+		{"Shift-F5", tcell.NewEventKey(tcell.KeyF5, 0, tcell.ModShift)},
+	}
+	for _, test := range tests {
+		binding, err := parseKey(test.name)
+		if err != nil {
+			t.Errorf("parseKey(%q): %v", test.name, err)
+			continue
+		}
+		if got := bindingOf(test.event); got != binding {
+			t.Errorf("parseKey(%q) = %+v, the event gives %+v", test.name, binding, got)
+		}
+	}
+}
+
+func TestParseKeyDistinguishesKeys(t *testing.T) {
+	tests := []struct {
+		name  string
+		event *tcell.EventKey
+	}{
+		{"Shift-s", tcell.NewEventKey(tcell.KeyRune, 's', tcell.ModNone)},
+		{"s", tcell.NewEventKey(tcell.KeyRune, 'S', tcell.ModShift)},
+		{"Alt-s", tcell.NewEventKey(tcell.KeyRune, 's', tcell.ModNone)},
+		{"F5", tcell.NewEventKey(tcell.KeyF5, 0, tcell.ModShift)},
+	}
+	for _, test := range tests {
+		binding, err := parseKey(test.name)
+		if err != nil {
+			t.Errorf("parseKey(%q): %v", test.name, err)
+			continue
+		}
+		if got := bindingOf(test.event); got == binding {
+			t.Errorf("parseKey(%q) matches %+v", test.name, got)
+		}
+	}
+}
+
+func TestParseKeyUnknown(t *testing.T) {
+	for _, name := range []string{"", "Alt-", "Ctrl-Foo", "ab"} {
+		if _, err := parseKey(name); err == nil {
+			t.Errorf("parseKey(%q) succeeded", name)
+		}
+	}
+}
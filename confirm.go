@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/rivo/tview"
+)
+
+// confirmSettings controls the confirmation of dangerous actions.
+type confirmSettings struct {
+	// typeName requires typing the VM name (or "yes" for several VMs)
+	// instead of pressing a button
+	typeName bool
+	// disabled holds the IDs of actions that run without confirmation
+	disabled map[string]bool
+}
+
+var confirmation = confirmSettings{disabled: map[string]bool{}}
+
+func (c confirmSettings) required(id string, action Action) bool {
+	return action.Dangerous() && !c.disabled[id]
+}
+
+// confirmPages counts the confirmation dialogs opened so far. Every dialog
+// gets its own page, so one opened while another is waiting for an answer
+// doesn't replace it. Only used from the UI goroutine.
+var confirmPages int
+
+func closeConfirm(pages *tview.Pages, page string) {
+	pages.RemovePage(page)
+}
+
+// confirmAction asks whether the action should really run on the named VMs.
+// onConfirm is called if the user agrees, onCancel otherwise.
+func confirmAction(pages *tview.Pages, action Action, names []string, onConfirm, onCancel func()) {
+	target := strings.Join(names, ", ")
+	if len(names) > 1 {
+		target = fmt.Sprintf("%d VMs (%s)", len(names), target)
+	}
+	question := fmt.Sprintf("%s %s?", action.StartMessage(), target)
+	confirmPages++
+	page := fmt.Sprintf("Confirm%d", confirmPages)
+
+	if !confirmation.typeName {
+		modal := tview.NewModal().
+			SetText(question).
+			AddButtons([]string{"Cancel", "Confirm"}).
+			SetDoneFunc(func(buttonIndex int, buttonLabel string) {
+				closeConfirm(pages, page)
+				if buttonLabel == "Confirm" {
+					onConfirm()
+				} else {
+					onCancel()
+				}
+			})
+		pages.AddPage(page, modal, true, true)
+		return
+	}
+
+	expected := "yes"
+	if len(names) == 1 {
+		expected = names[0]
+	}
+	form := tview.NewForm()
+	form.
+		AddTextView("", question, 0, 2, false, false).
+		AddInputField("Type "+expected+" to confirm: ", "", 30, nil, nil).
+		AddButton("Confirm", func() {
+			typed := form.GetFormItem(1).(*tview.InputField).GetText()
+			if typed != expected {
+				setStatus("Confirmation did not match, " + action.StartMessage() + " cancelled")
+				closeConfirm(pages, page)
+				onCancel()
+				return
+			}
+			closeConfirm(pages, page)
+			onConfirm()
+		}).
+		AddButton("Cancel", func() {
+			closeConfirm(pages, page)
+			onCancel()
+		})
+	form.SetBorder(true).SetTitle("Confirm").SetTitleAlign(tview.AlignLeft)
+	form.SetCancelFunc(func() {
+		closeConfirm(pages, page)
+		onCancel()
+	})
+
+	dialog := tview.NewFlex().
+		AddItem(nil, 0, 1, false).
+		AddItem(tview.NewFlex().
+			SetDirection(tview.FlexRow).
+			AddItem(nil, 0, 1, false).
+			AddItem(form, 9, 0, true).
+			AddItem(nil, 0, 1, false), 60, 0, true).
+		AddItem(nil, 0, 1, false)
+	pages.AddPage(page, dialog, true, true)
+}
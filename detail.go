@@ -0,0 +1,223 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/beevik/etree"
+	"github.com/dustin/go-humanize"
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+	"libvirt.org/go/libvirt"
+)
+
+var sparkBlocks = []rune("▁▂▃▄▅▆▇█")
+
+// sparkline renders the last width values scaled to their maximum.
+func sparkline(values []float64, width int) string {
+	if width <= 0 {
+		return ""
+	}
+	if len(values) > width {
+		values = values[len(values)-width:]
+	}
+	var max float64
+	for _, value := range values {
+		if value > max {
+			max = value
+		}
+	}
+	var builder strings.Builder
+	for _, value := range values {
+		i := 0
+		if max > 0 {
+			i = int(value / max * float64(len(sparkBlocks)-1))
+		}
+		builder.WriteRune(sparkBlocks[i])
+	}
+	return builder.String()
+}
+
+var memoryUnits = map[string]uint64{
+	"b": 1, "bytes": 1,
+	"KB": 1000, "k": 1024, "KiB": 1024,
+	"MB": 1000 * 1000, "M": 1024 * 1024, "MiB": 1024 * 1024,
+	"GB": 1000 * 1000 * 1000, "G": 1024 * 1024 * 1024, "GiB": 1024 * 1024 * 1024,
+	"TB": 1000 * 1000 * 1000 * 1000, "T": 1024 * 1024 * 1024 * 1024, "TiB": 1024 * 1024 * 1024 * 1024,
+}
+
+// memoryBytes converts a libvirt memory element, KiB unless stated otherwise.
+func memoryBytes(el *etree.Element) uint64 {
+	value, err := strconv.ParseUint(strings.TrimSpace(el.Text()), 10, 64)
+	if err != nil {
+		return 0
+	}
+	unit, ok := memoryUnits[el.SelectAttrValue("unit", "KiB")]
+	if !ok {
+		unit = 1024
+	}
+	return value * unit
+}
+
+// domainInfo describes the configuration of the domain: vCPUs, memory, OS,
+// disks and network interfaces.
+func domainInfo(dom *libvirt.Domain, addrSource libvirt.DomainInterfaceAddressesSource) (string, error) {
+	xmlDesc, err := dom.GetXMLDesc(0)
+	if err != nil {
+		return "", fmt.Errorf("failed to get XML description: %w", err)
+	}
+	doc := etree.NewDocument()
+	if err := doc.ReadFromString(xmlDesc); err != nil {
+		return "", fmt.Errorf("failed to parse XML: %w", err)
+	}
+
+	var builder strings.Builder
+	if vcpu := doc.FindElement("/domain/vcpu"); vcpu != nil {
+		max := strings.TrimSpace(vcpu.Text())
+		fmt.Fprintf(&builder, "vCPUs:    %s (max %s)\n", vcpu.SelectAttrValue("current", max), max)
+	}
+	if memory := doc.FindElement("/domain/memory"); memory != nil {
+		current := memory
+		if currentMemory := doc.FindElement("/domain/currentMemory"); currentMemory != nil {
+			current = currentMemory
+		}
+		fmt.Fprintf(&builder, "Memory:   %s (max %s)\n", humanize.IBytes(memoryBytes(current)), humanize.IBytes(memoryBytes(memory)))
+	}
+	if osType := doc.FindElement("/domain/os/type"); osType != nil {
+		fmt.Fprintf(&builder, "OS type:  %s (%s, %s)\n", osType.Text(), osType.SelectAttrValue("arch", "?"), osType.SelectAttrValue("machine", "?"))
+	}
+
+	builder.WriteString("\nDisks:\n")
+	disks, err := createDiskList(dom, 0)
+	if err != nil {
+		log.Println("Failed to get disks:", err)
+	}
+	for _, disk := range disks {
+		fmt.Fprintf(&builder, "  %-6s %-5s %s\n", disk.Device, disk.Type, disk.File)
+	}
+
+	builder.WriteString("\nNICs:\n")
+	interfaces, err := createInterfaceList(dom, 0)
+	if err != nil {
+		log.Println("Failed to get interfaces:", err)
+	}
+	if active, _ := dom.IsActive(); active {
+		if err := fillInterfaceAddresses(dom, interfaces, addrSource); err != nil {
+			log.Println("Failed to get interface addresses:", err)
+		}
+	}
+	for _, nic := range interfaces {
+		fmt.Fprintf(&builder, "  %s %s %s %s %s %s\n", nic.MAC, nic.Type, nic.Source, nic.Model, nic.Target, strings.Join(nic.IPs, ", "))
+	}
+	return builder.String(), nil
+}
+
+func uptime(entry *domainEntry) string {
+	switch {
+	case entry.state == libvirt.DOMAIN_SHUTOFF:
+		return "-"
+	case entry.started.IsZero():
+		return "unknown"
+	case entry.runningAtLoad:
+		return "at least " + time.Since(entry.started).Truncate(time.Second).String() + " (since virt-man-tui started)"
+	default:
+		return time.Since(entry.started).Truncate(time.Second).String()
+	}
+}
+
+func renderGraphs(view *tview.TextView, sp *StatProvider) {
+	_, _, width, _ := view.GetInnerRect()
+	sparkWidth := width - 30
+	hist := sp.history()
+	last := func(values []float64) float64 {
+		if len(values) == 0 {
+			return 0
+		}
+		return values[len(values)-1]
+	}
+
+	var builder strings.Builder
+	fmt.Fprintf(&builder, "CPU      %-12s %s\n", fmt.Sprintf("%.2f%%", last(hist.cpu)), sparkline(hist.cpu, sparkWidth))
+	fmt.Fprintf(&builder, "Memory   %-12s %s\n", humanize.IBytes(uint64(last(hist.memory))), sparkline(hist.memory, sparkWidth))
+	fmt.Fprintf(&builder, "Disk I/O %-12s %s\n", humanize.IBytes(uint64(last(hist.disk)))+"/s", sparkline(hist.disk, sparkWidth))
+	fmt.Fprintf(&builder, "Network  %-12s %s\n", humanize.IBytes(uint64(last(hist.network)))+"/s", sparkline(hist.network, sparkWidth))
+	view.SetText(builder.String())
+}
+
+func createDetailGrid(app *tview.Application, pages *tview.Pages, entry *domainEntry, addrSource libvirt.DomainInterfaceAddressesSource) *tview.Grid {
+	infoView := transparentTextView("")
+	infoView.SetBorder(true).SetTitle("Details of " + entry.name).SetTitleAlign(tview.AlignLeft)
+	breakdownView := transparentTextView("")
+	breakdownView.SetBorder(true).SetTitle("Devices").SetTitleAlign(tview.AlignLeft)
+	graphView := transparentTextView("")
+	graphView.SetBorder(true).SetTitle("Last " + historyWindow.String()).SetTitleAlign(tview.AlignLeft)
+
+	info := "\nLoading details...\n"
+	render := func() {
+		infoView.SetText(fmt.Sprintf("State:    %s\nUptime:   %s\n%s", humanState(entry.state), uptime(entry), info))
+		breakdownView.SetText(entry.stats.breakdown().String())
+		renderGraphs(graphView, entry.stats)
+	}
+	render()
+
+	// the info needs several calls, the addresses may even ask the guest
+	// agent, so it is filled in once it is there
+	dom := entry.dom
+	if err := dom.Ref(); err != nil {
+		log.Println("Failed to reference domain:", err)
+	} else {
+		go func() {
+			defer dom.Free()
+			loaded, err := domainInfo(dom, addrSource)
+			app.QueueUpdateDraw(func() {
+				if err != nil {
+					log.Println("Failed to get domain info:", err)
+					setStatus("Failed to get domain info: " + libvirtError(err))
+				}
+				info = loaded
+				render()
+			})
+		}()
+	}
+
+	stop := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				app.QueueUpdateDraw(render)
+			}
+		}
+	}()
+
+	detailGrid := tview.NewGrid().
+		SetRows(0, 0, 6, 1).
+		SetColumns(0).
+		SetBorders(false).
+		AddItem(infoView, 0, 0, 1, 1, 0, 0, true).
+		AddItem(breakdownView, 1, 0, 1, 1, 0, 0, false).
+		AddItem(graphView, 2, 0, 1, 1, 0, 0, false).
+		AddItem(statusView, 3, 0, 1, 1, 0, 0, false)
+	detailGrid.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if event.Key() == tcell.KeyEscape || event.Rune() == 'q' {
+			close(stop)
+			pages.SwitchToPage("MainTable")
+			pages.RemovePage("Details")
+			return nil
+		}
+		return event
+	})
+	return detailGrid
+}
+
+func showDetails(app *tview.Application, pages *tview.Pages, entry *domainEntry, addrSource libvirt.DomainInterfaceAddressesSource) {
+	pages.AddPage("Details", createDetailGrid(app, pages, entry, addrSource), true, false)
+	pages.SwitchToPage("Details")
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"log"
+
+	"libvirt.org/go/libvirt"
+)
+
+// deviceModifyModes are the choices of device forms for where a change
+// applies: the running domain, its persistent config or both.
+var deviceModifyModes = []string{"Live", "Config", "Both"}
+
+func deviceModifyFlags(mode int) libvirt.DomainDeviceModifyFlags {
+	switch mode {
+	case 0:
+		return libvirt.DOMAIN_DEVICE_MODIFY_LIVE
+	case 1:
+		return libvirt.DOMAIN_DEVICE_MODIFY_CONFIG
+	default:
+		return libvirt.DOMAIN_DEVICE_MODIFY_LIVE | libvirt.DOMAIN_DEVICE_MODIFY_CONFIG
+	}
+}
+
+// defaultModifyMode is the config for a shut off domain, a live change would
+// fail, live for a transient one, which has no config, and both for a running
+// persistent one.
+func defaultModifyMode(dom *libvirt.Domain) int {
+	active, err := dom.IsActive()
+	if err != nil {
+		log.Println("Failed to get domain state:", err)
+	}
+	if !active {
+		return 1
+	}
+	persistent, err := dom.IsPersistent()
+	if err != nil {
+		log.Println("Failed to check if domain is persistent:", err)
+	}
+	if !persistent {
+		return 0
+	}
+	return 2
+}
+
+// deviceXMLFlags returns how to read the domain XML holding the devices a
+// change with the flags applies to: the persistent config for a change to
+// the config only, the live definition otherwise.
+func deviceXMLFlags(flags libvirt.DomainDeviceModifyFlags) libvirt.DomainXMLFlags {
+	if flags&libvirt.DOMAIN_DEVICE_MODIFY_LIVE == 0 && flags&libvirt.DOMAIN_DEVICE_MODIFY_CONFIG != 0 {
+		return libvirt.DOMAIN_XML_INACTIVE
+	}
+	return 0
+}
+
+// detachModifyFlags returns where a device has to be unplugged from: the
+// running domain if it is plugged in there and the config if it is in there.
+// inXML reports whether the device is in the domain XML read with the flags.
+func detachModifyFlags(dom *libvirt.Domain, inXML func(libvirt.DomainXMLFlags) bool) libvirt.DomainDeviceModifyFlags {
+	var flags libvirt.DomainDeviceModifyFlags
+	if active, err := dom.IsActive(); err == nil && active && inXML(0) {
+		flags |= libvirt.DOMAIN_DEVICE_MODIFY_LIVE
+	}
+	if persistent, err := dom.IsPersistent(); err == nil && persistent && inXML(libvirt.DOMAIN_XML_INACTIVE) {
+		flags |= libvirt.DOMAIN_DEVICE_MODIFY_CONFIG
+	}
+	if flags == 0 {
+		return deviceModifyFlags(defaultModifyMode(dom))
+	}
+	return flags
+}
+
+// modifyFlagsArg takes --live and --config out of palette arguments, both
+// together mean both. ok is false if neither was given.
+func modifyFlagsArg(args []string) (flags libvirt.DomainDeviceModifyFlags, rest []string, ok bool) {
+	for _, arg := range args {
+		switch arg {
+		case "--live":
+			flags |= libvirt.DOMAIN_DEVICE_MODIFY_LIVE
+		case "--config":
+			flags |= libvirt.DOMAIN_DEVICE_MODIFY_CONFIG
+		default:
+			rest = append(rest, arg)
+		}
+	}
+	return flags, rest, flags != 0
+}
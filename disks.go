@@ -1,12 +1,16 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"log"
-	"path/filepath"
+	"slices"
 	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/beevik/etree"
+	"github.com/dustin/go-humanize"
 	"github.com/rivo/tview"
 	"libvirt.org/go/libvirt"
 )
@@ -14,59 +18,309 @@ import (
 type diskAction struct {
 	title      string
 	submitfunc func(*tview.Form) error
+	// close removes the form and releases what it holds
+	close func()
 }
+
+// diskFormCloser returns the close function of a disk form. The form keeps a
+// reference to dom, the domain could be undefined while it is open.
+func diskFormCloser(pages *tview.Pages, dom *libvirt.Domain) (func(), error) {
+	if err := dom.Ref(); err != nil {
+		return nil, err
+	}
+	return func() {
+		pages.SwitchToPage("MainTable")
+		pages.RemovePage("DiskForm")
+		dom.Free()
+	}, nil
+}
+
 type Disk struct {
+	// Device is the target dev, e.g. vda
 	Device string
-	File   string
-	Type   string
+	// File is the file, block device or network source, empty for an
+	// empty cdrom drive
+	File string
+	// Type is the device type, disk, cdrom or lun
+	Type string
+	// XML is the disk's exact <disk> element from the domain
+	XML string
 }
 
-func createAttachDiskForm(pages *tview.Pages, dom *libvirt.Domain, diskAction diskAction) *tview.Form {
+// newVolumeOption is the volume choice that creates a new volume before
+// attaching it. It comes last and no volume is chosen up front, so nothing
+// is created by accident.
+const newVolumeOption = "<new volume>"
+
+// diskSources are where the attach form takes the disk from.
+var diskSources = []string{"Storage volume", "Path", "Network"}
+
+// createAttachDiskForm shows the form straight away, the pools, their
+// volumes and the used target devs are loaded in the background as listing
+// volumes takes several calls per volume.
+func createAttachDiskForm(app *tview.Application, dom *libvirt.Domain, conn *libvirt.Connect, diskAction diskAction) *tview.Form {
 	vmName, err := dom.GetName()
 	if err != nil {
 		vmName = ""
 	}
-	form := tview.NewForm()
-	diskPathInput := tview.NewInputField().
-		SetLabel("Disk Path: ").
-		SetFieldWidth(30).
-		SetAutocompleteFunc(func(currentText string) (entries []string) {
-			if len(currentText) == 0 {
-				return
-			}
-			dir, prefix := filepath.Split(currentText)
-			files, _ := filepath.Glob(dir + "*")
-			for _, file := range files {
-				if strings.HasPrefix(file, dir+prefix) {
-					entries = append(entries, file)
-				}
-			}
-
-			if len(entries) <= 1 {
-				entries = nil
-			}
+	// background runs fetch with its own reference to conn, which the form
+	// closes, and applies the result on the UI goroutine
+	background := func(fetch func() (apply func())) {
+		if err := conn.Ref(); err != nil {
+			log.Println("Failed to reference connection:", err)
+			return
+		}
+		go func() {
+			defer conn.Close()
+			app.QueueUpdateDraw(fetch())
+		}()
+	}
+	usedTargets := make(map[string]bool)
+	// volumeLoads counts the started volume loads, only the last one is shown
+	var volumeLoads atomic.Int64
 
+	form := tview.NewForm().SetItemPadding(0)
+	volumeDropDown := tview.NewDropDown().
+		SetLabel("Volume: ").
+		SetOptions([]string{newVolumeOption}, nil).
+		SetCurrentOption(-1)
+	loadVolumes := func(poolName string, index int) {
+		gen := volumeLoads.Add(1)
+		volumeDropDown.SetOptions([]string{newVolumeOption}, nil)
+		volumeDropDown.SetCurrentOption(-1)
+		if index < 0 {
 			return
+		}
+		background(func() func() {
+			volumes, err := listVolumes(conn, poolName)
+			return func() {
+				if volumeLoads.Load() != gen {
+					return
+				}
+				if err != nil {
+					log.Println("Failed to list volumes:", err)
+					setStatus("Failed to list volumes of " + poolName + ": " + libvirtError(err))
+				}
+				var options []string
+				for _, vol := range volumes {
+					options = append(options, vol.name)
+				}
+				volumeDropDown.SetOptions(append(options, newVolumeOption), nil)
+				volumeDropDown.SetCurrentOption(-1)
+			}
 		})
+	}
+	poolDropDown := tview.NewDropDown().
+		SetLabel("Pool: ")
 	targetDevInput := tview.NewInputField().
 		SetLabel("Target Dev: ").
 		SetFieldWidth(30)
+	busDropDown := tview.NewDropDown().
+		SetLabel("Bus: ").
+		SetOptions(diskBuses, func(bus string, index int) {
+			targetDevInput.SetText(suggestTargetDev(usedTargets, bus))
+		}).
+		SetCurrentOption(0)
 	form.
-		AddFormItem(diskPathInput).
+		AddDropDown("Device: ", diskDevices, 0, func(device string, index int) {
+			// virtio has no removable media
+			if _, bus := busDropDown.GetCurrentOption(); device == "cdrom" && bus == "virtio" {
+				busDropDown.SetCurrentOption(slices.Index(diskBuses, "sata"))
+			}
+		}).
+		AddDropDown("Source: ", diskSources, 0, nil).
+		AddFormItem(poolDropDown).
+		AddFormItem(volumeDropDown).
+		AddInputField("New volume name: ", vmName+"-"+time.Now().Format("20060102-150405")+".qcow2", 40, nil, nil).
+		AddInputField("New volume size: ", "10GiB", 15, nil, nil).
+		AddDropDown("New volume format: ", []string{"qcow2", "raw"}, 0, nil).
+		AddInputField("Path: ", "", 50, nil, nil).
+		AddDropDown("Protocol: ", diskProtocols, 0, nil).
+		AddInputField("Host: ", "", 30, nil, nil).
+		AddInputField("Network name: ", "", 40, nil, nil).
+		AddDropDown("Format: ", diskFormats, 0, nil).
+		AddFormItem(busDropDown).
 		AddFormItem(targetDevInput).
+		AddDropDown("Cache: ", diskCacheModes, 0, nil).
+		AddDropDown("IO: ", diskIOModes, 0, nil).
+		AddCheckbox("Read-only: ", false, nil).
+		AddCheckbox("Shareable: ", false, nil).
+		AddDropDown("Apply to: ", deviceModifyModes, defaultModifyMode(dom), nil).
 		AddButton("Submit", func() {
 			diskAction.submitfunc(form)
 		}).
-		AddButton("Cancel", func() {
-			pages.SwitchToPage("MainTable")
-			pages.RemovePage("DiskForm")
-		})
+		AddButton("Cancel", diskAction.close)
+	form.SetCancelFunc(diskAction.close)
 	form.SetBorder(true).SetTitle(diskAction.title + " " + vmName).SetTitleAlign(tview.AlignLeft)
+
+	background(func() func() {
+		pools, err := listPools(conn)
+		used, targetsErr := usedTargetDevs(dom)
+		return func() {
+			if err != nil {
+				log.Println("Failed to list storage pools:", err)
+				setStatus("Failed to list storage pools: " + libvirtError(err))
+			}
+			var poolNames []string
+			for _, pool := range pools {
+				if pool.state == libvirt.STORAGE_POOL_RUNNING {
+					poolNames = append(poolNames, pool.name)
+				}
+			}
+			if targetsErr != nil {
+				log.Println("Failed to get disk targets:", targetsErr)
+			} else {
+				usedTargets = used
+				_, bus := busDropDown.GetCurrentOption()
+				targetDevInput.SetText(suggestTargetDev(usedTargets, bus))
+			}
+			poolDropDown.SetOptions(poolNames, loadVolumes)
+			if len(poolNames) > 0 {
+				poolDropDown.SetCurrentOption(0)
+			}
+		}
+	})
 	return form
 }
 
-func createAttachDiskGrid(pages *tview.Pages, dom *libvirt.Domain, diskAction diskAction) *tview.Grid {
-	form := createAttachDiskForm(pages, dom, diskAction)
+// diskRequest is a disk to attach as collected from the attach form. The
+// libvirt calls it needs are left to attach, which runs as a job.
+type diskRequest struct {
+	spec diskSpec
+	// newVolumeSize and newVolumeFormat describe the volume to create
+	// first, there is none if the size is 0
+	newVolumeSize   uint64
+	newVolumeFormat string
+}
+
+// attach creates the new volume, finds the format if it is left to auto and
+// attaches the disk. The new volume is deleted again if that fails.
+func (r diskRequest) attach(dom *libvirt.Domain, flags libvirt.DomainDeviceModifyFlags) (err error) {
+	conn, err := dom.DomainGetConnect()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	spec := r.spec
+	if r.newVolumeSize > 0 {
+		if err := createVolume(conn, spec.pool, spec.volume, r.newVolumeSize, r.newVolumeFormat); err != nil {
+			return err
+		}
+		defer func() {
+			if err == nil {
+				return
+			}
+			if err := deleteVolume(conn, spec.pool, spec.volume); err != nil {
+				log.Println("Failed to delete new volume:", err)
+			}
+		}()
+	}
+	switch spec.sourceType {
+	case "volume":
+		volType, format, err := volumeTypeAndFormat(conn, spec.pool, spec.volume)
+		if err != nil {
+			return err
+		}
+		if spec.device == "lun" && volType != libvirt.STORAGE_VOL_BLOCK && volType != libvirt.STORAGE_VOL_NETWORK {
+			return errors.New("a LUN needs a block device or network volume")
+		}
+		if spec.format == "auto" {
+			spec.format = format
+		}
+	case "file", "block":
+		if spec.format == "auto" {
+			if spec.format, err = detectDiskFormat(conn, spec.path); err != nil {
+				return err
+			}
+		}
+	}
+	return attachSpecificDisk(dom, spec, flags)
+}
+
+// diskRequestFromForm collects and checks the attach form. It makes no
+// libvirt calls, they are left to the job.
+func diskRequestFromForm(form *tview.Form) (diskRequest, error) {
+	option := func(label string) string {
+		_, text := form.GetFormItemByLabel(label).(*tview.DropDown).GetCurrentOption()
+		return text
+	}
+	text := func(label string) string {
+		return strings.TrimSpace(form.GetFormItemByLabel(label).(*tview.InputField).GetText())
+	}
+	var request diskRequest
+	spec := diskSpec{
+		device:    option("Device: "),
+		format:    option("Format: "),
+		bus:       option("Bus: "),
+		target:    text("Target Dev: "),
+		cache:     option("Cache: "),
+		io:        option("IO: "),
+		readOnly:  form.GetFormItemByLabel("Read-only: ").(*tview.Checkbox).IsChecked(),
+		shareable: form.GetFormItemByLabel("Shareable: ").(*tview.Checkbox).IsChecked(),
+	}
+	if spec.target == "" {
+		return diskRequest{}, errors.New("the disk needs a target dev")
+	}
+
+	switch option("Source: ") {
+	case "Storage volume":
+		spec.sourceType = "volume"
+		spec.pool = option("Pool: ")
+		spec.volume = option("Volume: ")
+		if spec.pool == "" {
+			return diskRequest{}, errors.New("no running storage pool")
+		}
+		if spec.volume == "" {
+			return diskRequest{}, errors.New("no volume chosen")
+		}
+		if spec.volume == newVolumeOption {
+			spec.volume = text("New volume name: ")
+			if spec.volume == "" {
+				return diskRequest{}, errors.New("the new volume needs a name")
+			}
+			size, err := humanize.ParseBytes(text("New volume size: "))
+			if err != nil {
+				return diskRequest{}, fmt.Errorf("invalid size: %w", err)
+			}
+			if size == 0 {
+				return diskRequest{}, errors.New("the new volume needs a size")
+			}
+			request.newVolumeSize = size
+			request.newVolumeFormat = option("New volume format: ")
+		}
+	case "Path":
+		spec.path = text("Path: ")
+		if spec.path == "" {
+			return diskRequest{}, errors.New("the disk needs a path")
+		}
+		spec.sourceType = "file"
+		if strings.HasPrefix(spec.path, "/dev/") {
+			spec.sourceType = "block"
+		}
+	case "Network":
+		spec.sourceType = "network"
+		spec.protocol = option("Protocol: ")
+		spec.host = text("Host: ")
+		spec.name = text("Network name: ")
+		if spec.name == "" {
+			return diskRequest{}, errors.New("the network disk needs a name")
+		}
+		if spec.format == "auto" {
+			return diskRequest{}, errors.New("the format of a network disk can't be detected, choose it")
+		}
+	}
+	if spec.device == "lun" && spec.sourceType == "file" {
+		return diskRequest{}, errors.New("a LUN needs a block device or network source")
+	}
+	if err := spec.checkBus(); err != nil {
+		return diskRequest{}, err
+	}
+	request.spec = spec
+	return request, nil
+}
+
+func createAttachDiskGrid(app *tview.Application, dom *libvirt.Domain, conn *libvirt.Connect, diskAction diskAction) *tview.Grid {
+	form := createAttachDiskForm(app, dom, conn, diskAction)
 	diskGrid := tview.NewGrid().
 		SetRows(0, 1).
 		SetColumns(0).
@@ -75,41 +329,110 @@ func createAttachDiskGrid(pages *tview.Pages, dom *libvirt.Domain, diskAction di
 		AddItem(form, 0, 0, 1, 1, 0, 0, true)
 	return diskGrid
 }
-func attachDisk(dom *libvirt.Domain, app *tview.Application, pages *tview.Pages) error {
+
+// attachDisk asks for the disk to attach. Submitting the form queues a job
+// that creates a new volume and attaches the disk, the form only checks the
+// input.
+func attachDisk(dom *libvirt.Domain, app *tview.Application, pages *tview.Pages, jobs *jobQueue) error {
+	vmName, err := dom.GetName()
+	if err != nil {
+		vmName = ""
+	}
+	conn, err := dom.DomainGetConnect()
+	if err != nil {
+		return err
+	}
+	closeDiskForm, err := diskFormCloser(pages, dom)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	// the connection is only closed with the form, however it is left
+	closeForm := func() {
+		closeDiskForm()
+		conn.Close()
+	}
 	attachAction := diskAction{
 		"Attach disk to",
 		func(form *tview.Form) error {
-			diskPath := form.GetFormItemByLabel("Disk Path: ").(*tview.InputField).GetText()
-			targetDev := form.GetFormItemByLabel("Target Dev: ").(*tview.InputField).GetText()
-			if err := attachSpecificDisk(dom, diskPath, targetDev); err != nil {
-				log.Println("Failed to attach disk:", err)
+			mode, _ := form.GetFormItemByLabel("Apply to: ").(*tview.DropDown).GetCurrentOption()
+			request, err := diskRequestFromForm(form)
+			if err != nil {
 				setStatus("Failed to attach disk: " + err.Error())
 				return err
-			} else {
-				log.Println("Disk attached successfully")
-				pages.SwitchToPage("MainTable")
-				pages.RemovePage("DiskForm")
 			}
+			action := NewSimpleAction(Meta{label: "Attach disk"}, "Attaching disk to", "attached disk to", "Failed to attach disk to", func(d *libvirt.Domain) error {
+				return request.attach(d, deviceModifyFlags(mode))
+			})
+			submitDomainJob(jobs, action, dom, vmName, nil)
+			closeForm()
 			return nil
 		},
+		closeForm,
 	}
 
-	pages.AddPage("DiskForm", createAttachDiskGrid(pages, dom, attachAction), true, false)
+	pages.AddPage("DiskForm", createAttachDiskGrid(app, dom, conn, attachAction), true, false)
 	pages.SwitchToPage("DiskForm")
 	return nil
 }
 
-// TODO: disk type
-func attachSpecificDisk(dom *libvirt.Domain, diskPath string, targetDev string) error {
-	diskXML := fmt.Sprintf(`
-    <disk type='file' device='disk'>
-        <driver name='qemu' type='qcow2'/>
-        <source file='%s'/>
-        <target dev='%s' bus='virtio'/>
-    </disk>
-    `, diskPath, targetDev)
+// attachDiskArgs attaches the file or block device given as "<path> [target
+// dev]" as a virtio disk. The format is detected if it isn't given with
+// --format=raw|qcow2, which only works for volumes and on a local
+// connection. Without a target dev the first free one is used. --live or
+// --config choose where.
+func attachDiskArgs(dom *libvirt.Domain, args []string) error {
+	flags, args, ok := modifyFlagsArg(args)
+	if !ok {
+		flags = deviceModifyFlags(defaultModifyMode(dom))
+	}
+	var format string
+	var rest []string
+	for _, arg := range args {
+		if value, found := strings.CutPrefix(arg, "--format="); found {
+			format = value
+		} else {
+			rest = append(rest, arg)
+		}
+	}
+	args = rest
+	if len(args) < 1 || len(args) > 2 {
+		return errors.New("usage: attach-disk <path> [target dev] [--format=raw|qcow2] [--live] [--config]")
+	}
+	conn, err := dom.DomainGetConnect()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	spec := diskSpec{device: "disk", sourceType: "file", path: args[0], bus: "virtio"}
+	if strings.HasPrefix(spec.path, "/dev/") {
+		spec.sourceType = "block"
+	}
+	spec.format = format
+	if spec.format == "" {
+		if spec.format, err = detectDiskFormat(conn, spec.path); err != nil {
+			return err
+		}
+	}
+	if len(args) == 2 {
+		spec.target = args[1]
+	} else {
+		used, err := usedTargetDevs(dom)
+		if err != nil {
+			return err
+		}
+		spec.target = suggestTargetDev(used, spec.bus)
+	}
+	return attachSpecificDisk(dom, spec, flags)
+}
+
+func attachSpecificDisk(dom *libvirt.Domain, spec diskSpec, flags libvirt.DomainDeviceModifyFlags) error {
+	diskXML, err := spec.xml()
+	if err != nil {
+		return err
+	}
 
-	if err := dom.AttachDeviceFlags(diskXML, libvirt.DOMAIN_DEVICE_MODIFY_LIVE); err != nil {
+	if err := dom.AttachDeviceFlags(diskXML, flags); err != nil {
 		log.Println("Failed to hotplug disk:", err)
 		return err
 	}
@@ -117,10 +440,38 @@ func attachSpecificDisk(dom *libvirt.Domain, diskPath string, targetDev string)
 	return nil
 }
 
-func createDiskList(dom *libvirt.Domain) ([]Disk, error) {
+// diskSourceDesc describes where the disk's data comes from: its file or block
+// device, or protocol://host/name for a network disk.
+func diskSourceDesc(disk *etree.Element) string {
+	source := disk.SelectElement("source")
+	if source == nil {
+		return ""
+	}
+	switch disk.SelectAttrValue("type", "file") {
+	case "block":
+		return source.SelectAttrValue("dev", "")
+	case "network":
+		desc := source.SelectAttrValue("protocol", "") + "://"
+		if host := source.SelectElement("host"); host != nil {
+			desc += host.SelectAttrValue("name", "")
+			if port := host.SelectAttrValue("port", ""); port != "" {
+				desc += ":" + port
+			}
+		}
+		return desc + "/" + source.SelectAttrValue("name", "")
+	case "volume":
+		return source.SelectAttrValue("pool", "") + "/" + source.SelectAttrValue("volume", "")
+	default:
+		return source.SelectAttrValue("file", "")
+	}
+}
+
+// createDiskList lists the disks of the domain, from the live XML or, with
+// DOMAIN_XML_INACTIVE, from the persistent config.
+func createDiskList(dom *libvirt.Domain, xmlFlags libvirt.DomainXMLFlags) ([]Disk, error) {
 	var disks []Disk
 
-	xmlDesc, err := dom.GetXMLDesc(0)
+	xmlDesc, err := dom.GetXMLDesc(xmlFlags)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get XML description: %w", err)
 	}
@@ -128,60 +479,78 @@ func createDiskList(dom *libvirt.Domain) ([]Disk, error) {
 	if err := doc.ReadFromString(xmlDesc); err != nil {
 		return nil, fmt.Errorf("failed to parse XML: %w", err)
 	}
-	diskElements := doc.FindElements("//disk")
+	diskElements := doc.FindElements("//devices/disk")
 	for _, disk := range diskElements {
-		source := disk.SelectElement("source")
 		target := disk.SelectElement("target")
-		if source != nil && target != nil {
-			file := source.SelectAttrValue("file", "")
-			dev := target.SelectAttrValue("dev", "")
-			disks = append(disks, Disk{Device: dev, File: file})
+		if target == nil {
+			continue
+		}
+		diskDoc := etree.NewDocument()
+		diskDoc.SetRoot(disk.Copy())
+		diskXML, err := diskDoc.WriteToString()
+		if err != nil {
+			return nil, fmt.Errorf("failed to write disk XML: %w", err)
 		}
+		disks = append(disks, Disk{
+			Device: target.SelectAttrValue("dev", ""),
+			File:   diskSourceDesc(disk),
+			Type:   disk.SelectAttrValue("device", "disk"),
+			XML:    diskXML,
+		})
 	}
 
 	return disks, nil
 }
 
-func createDetachDiskForm(pages *tview.Pages, dom *libvirt.Domain, diskAction diskAction) *tview.Form {
+// diskOptions describes the disks for the detach form.
+func diskOptions(disks []Disk) []string {
+	options := make([]string, 0, len(disks))
+	for _, disk := range disks {
+		file := disk.File
+		if file == "" {
+			file = "(empty)"
+		}
+		options = append(options, fmt.Sprintf("%s (%s, %s)", disk.Device, disk.Type, file))
+	}
+	return options
+}
+
+// createDetachDiskForm lists the disks in *diskList whenever Apply to
+// changes, those of the live domain or, when only the config is changed, of
+// the config.
+func createDetachDiskForm(pages *tview.Pages, dom *libvirt.Domain, diskList *[]Disk, diskAction diskAction) *tview.Form {
 	vmName, err := dom.GetName()
 	if err != nil {
 		vmName = ""
 	}
-	diskList, err := createDiskList(dom)
-	diskOptions := make([]string, 0, len(diskList))
-
-	for _, disk := range diskList {
-		diskOptions = append(diskOptions, fmt.Sprintf("Device: %s, File: %s", disk.Device, disk.File))
-	}
 	form := tview.NewForm()
+	diskDropDown := tview.NewDropDown().
+		SetLabel("Disks: ")
 	form.
-		AddDropDown("Disks: ", diskOptions, 0, func(option string, optionIndex int) {
-			diskInfo := strings.Split(option, ", ")
-			diskDevice := strings.Split(diskInfo[0], ": ")[1]
-			diskFile := strings.Split(diskInfo[1], ": ")[1]
-
-			if err := detachSpecificDisk(dom, diskDevice, diskFile); err != nil {
-				log.Println("Failed to detach disk:", err)
-				setStatus("Failed to detach disk: " + err.Error())
-			} else {
-				log.Println("Disk detached successfully")
-				pages.SwitchToPage("MainTable")
-				pages.RemovePage("DiskForm")
+		AddFormItem(diskDropDown).
+		AddDropDown("Apply to: ", deviceModifyModes, defaultModifyMode(dom), func(option string, mode int) {
+			list, err := createDiskList(dom, deviceXMLFlags(deviceModifyFlags(mode)))
+			if err != nil {
+				log.Println("Failed to get disks:", err)
+				setStatus("Failed to get disks: " + libvirtError(err))
 			}
+			*diskList = list
+			diskDropDown.SetOptions(diskOptions(list), nil)
+			diskDropDown.SetCurrentOption(0)
 		}).
 		AddButton("Submit", func() {
 			diskAction.submitfunc(form)
 		}).
 		AddButton("Cancel", func() {
-			pages.SwitchToPage("MainTable")
-			pages.RemovePage("DiskForm")
+			diskAction.close()
 		})
+	form.SetCancelFunc(diskAction.close)
 	form.SetBorder(true).SetTitle(diskAction.title + " " + vmName).SetTitleAlign(tview.AlignLeft)
 	return form
 }
 
-func createDetachDiskGrid(pages *tview.Pages, dom *libvirt.Domain, diskAction diskAction) *tview.Grid {
-	form := createDetachDiskForm(pages, dom, diskAction)
+func createDetachDiskGrid(pages *tview.Pages, dom *libvirt.Domain, diskList *[]Disk, diskAction diskAction) *tview.Grid {
+	form := createDetachDiskForm(pages, dom, diskList, diskAction)
 	diskGrid := tview.NewGrid().
 		SetRows(0, 1).
 		SetColumns(0).
@@ -190,44 +559,87 @@ func createDetachDiskGrid(pages *tview.Pages, dom *libvirt.Domain, diskAction di
 		AddItem(form, 0, 0, 1, 1, 0, 0, true)
 	return diskGrid
 }
-func detachDisk(dom *libvirt.Domain, app *tview.Application, pages *tview.Pages) error {
+
+// detachDisk asks which disk to unplug and queues a job for it, a live
+// detach waits for the guest to release the disk.
+func detachDisk(dom *libvirt.Domain, pages *tview.Pages, jobs *jobQueue) error {
+	vmName, err := dom.GetName()
+	if err != nil {
+		vmName = ""
+	}
+	// the disks are listed by the form when Apply to is chosen
+	var diskList []Disk
+	closeForm, err := diskFormCloser(pages, dom)
+	if err != nil {
+		return err
+	}
 	detachAction := diskAction{
 		"Detach disk from",
 		func(form *tview.Form) error {
-			_, dropText := form.GetFormItemByLabel("Disks: ").(*tview.DropDown).GetCurrentOption()
-			diskInfo := strings.Split(dropText, ", ")
-			targetDev := strings.Split(diskInfo[0], ": ")[1]
-			diskPath := strings.Split(diskInfo[1], ": ")[1]
-			if err := detachSpecificDisk(dom, diskPath, targetDev); err != nil {
-				log.Println("Failed to detach disk:", err)
-				setStatus("Failed to detach disk: " + err.Error())
-				return err
-			} else {
-				log.Println("Disk detached successfully")
-				pages.SwitchToPage("MainTable")
-				pages.RemovePage("DiskForm")
+			index, _ := form.GetFormItemByLabel("Disks: ").(*tview.DropDown).GetCurrentOption()
+			if index < 0 || index >= len(diskList) {
+				setStatus("No disk to detach")
+				return nil
 			}
+			mode, _ := form.GetFormItemByLabel("Apply to: ").(*tview.DropDown).GetCurrentOption()
+			targetDev := diskList[index].Device
+			action := NewSimpleAction(Meta{label: "Detach disk"}, "Detaching disk "+targetDev+" from", "detached disk "+targetDev+" from", "Failed to detach disk "+targetDev+" from", func(d *libvirt.Domain) error {
+				return detachSpecificDisk(d, targetDev, deviceModifyFlags(mode))
+			})
+			submitDomainJob(jobs, action, dom, vmName, nil)
+			closeForm()
 			return nil
 		},
+		closeForm,
 	}
-	pages.AddPage("DiskForm", createDetachDiskGrid(pages, dom, detachAction), true, false)
+	pages.AddPage("DiskForm", createDetachDiskGrid(pages, dom, &diskList, detachAction), true, false)
 	pages.SwitchToPage("DiskForm")
 	return nil
 }
 
-func detachSpecificDisk(dom *libvirt.Domain, diskPath string, targetDev string) error {
-	diskXML := fmt.Sprintf(`
-    <disk type='file' device='disk'>
-        <driver name='qemu' type='qcow2'/>
-        <source file='%s'/>
-        <target dev='%s' bus='virtio'/>
-    </disk>
-    `, diskPath, targetDev)
+// detachDiskArgs detaches the disk given by its target dev. --live or
+// --config choose where, by default it is wherever the disk is.
+func detachDiskArgs(dom *libvirt.Domain, args []string) error {
+	flags, args, ok := modifyFlagsArg(args)
+	if len(args) != 1 {
+		return errors.New("usage: detach-disk <target dev> [--live] [--config]")
+	}
+	targetDev := args[0]
+	if !ok {
+		flags = detachModifyFlags(dom, func(xmlFlags libvirt.DomainXMLFlags) bool {
+			disks, err := createDiskList(dom, xmlFlags)
+			if err != nil {
+				return false
+			}
+			for _, disk := range disks {
+				if disk.Device == targetDev {
+					return true
+				}
+			}
+			return false
+		})
+	}
+	return detachSpecificDisk(dom, targetDev, flags)
+}
 
-	if err := dom.DetachDeviceFlags(diskXML, libvirt.DOMAIN_DEVICE_MODIFY_LIVE); err != nil {
-		log.Println("Failed to detach disk:", err)
+// detachSpecificDisk unplugs the disk with the target dev, using its exact
+// XML from the domain so that any disk type matches. A disk only detached
+// from the config is looked up in the config.
+func detachSpecificDisk(dom *libvirt.Domain, targetDev string, flags libvirt.DomainDeviceModifyFlags) error {
+	disks, err := createDiskList(dom, deviceXMLFlags(flags))
+	if err != nil {
 		return err
 	}
-	log.Println("Disk detached successfully")
-	return nil
+	for _, disk := range disks {
+		if disk.Device != targetDev {
+			continue
+		}
+		if err := dom.DetachDeviceFlags(disk.XML, flags); err != nil {
+			log.Println("Failed to detach disk:", err)
+			return err
+		}
+		log.Println("Disk detached successfully")
+		return nil
+	}
+	return fmt.Errorf("no disk with target dev %s", targetDev)
 }
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/beevik/etree"
+	"libvirt.org/go/libvirt"
+)
+
+var (
+	diskDevices    = []string{"disk", "cdrom", "lun"}
+	diskBuses      = []string{"virtio", "scsi", "sata", "usb"}
+	diskCacheModes = []string{"default", "none", "writethrough", "writeback", "directsync", "unsafe"}
+	diskIOModes    = []string{"default", "native", "threads", "io_uring"}
+	diskFormats    = []string{"auto", "raw", "qcow2"}
+	diskProtocols  = []string{"nbd", "rbd", "iscsi", "http", "https"}
+)
+
+// diskSpec is everything the attach form asks about a disk.
+type diskSpec struct {
+	// device is disk, cdrom or lun
+	device string
+	// sourceType is file, block, volume or network
+	sourceType string
+	// path is the file or block device
+	path string
+	// pool and volume name a storage volume, which libvirt resolves for
+	// every pool type
+	pool   string
+	volume string
+	// protocol, host (host[:port]) and name locate a network disk
+	protocol string
+	host     string
+	name     string
+	format   string
+	bus      string
+	target   string
+	// cache and io are left to the hypervisor when empty or "default"
+	cache     string
+	io        string
+	readOnly  bool
+	shareable bool
+}
+
+// checkBus rejects a cdrom on virtio, which has no removable media.
+func (s diskSpec) checkBus() error {
+	if s.device == "cdrom" && s.bus == "virtio" {
+		return errors.New("virtio doesn't support cdroms, use sata or scsi")
+	}
+	return nil
+}
+
+// xml returns the <disk> element for the spec.
+func (s diskSpec) xml() (string, error) {
+	if err := s.checkBus(); err != nil {
+		return "", err
+	}
+	doc := etree.NewDocument()
+	disk := doc.CreateElement("disk")
+	disk.CreateAttr("type", s.sourceType)
+	disk.CreateAttr("device", s.device)
+
+	driver := disk.CreateElement("driver")
+	driver.CreateAttr("name", "qemu")
+	driver.CreateAttr("type", s.format)
+	if s.cache != "" && s.cache != "default" {
+		driver.CreateAttr("cache", s.cache)
+	}
+	if s.io != "" && s.io != "default" {
+		driver.CreateAttr("io", s.io)
+	}
+
+	// a volume is checked by its type before, see diskRequest.attach
+	if s.device == "lun" && s.sourceType == "file" {
+		return "", errors.New("a LUN needs a block device or network source")
+	}
+	source := disk.CreateElement("source")
+	switch s.sourceType {
+	case "file":
+		source.CreateAttr("file", s.path)
+	case "block":
+		source.CreateAttr("dev", s.path)
+	case "volume":
+		source.CreateAttr("pool", s.pool)
+		source.CreateAttr("volume", s.volume)
+	case "network":
+		source.CreateAttr("protocol", s.protocol)
+		source.CreateAttr("name", s.name)
+		if s.host != "" {
+			host := source.CreateElement("host")
+			name, port, found := strings.Cut(s.host, ":")
+			host.CreateAttr("name", name)
+			if found {
+				host.CreateAttr("port", port)
+			}
+		}
+	default:
+		return "", fmt.Errorf("unknown source type %q", s.sourceType)
+	}
+
+	target := disk.CreateElement("target")
+	target.CreateAttr("dev", s.target)
+	target.CreateAttr("bus", s.bus)
+	if s.readOnly || s.device == "cdrom" {
+		disk.CreateElement("readonly")
+	}
+	if s.shareable {
+		disk.CreateElement("shareable")
+	}
+	return doc.WriteToString()
+}
+
+// qcow2Magic starts every qcow2 image.
+var qcow2Magic = []byte{'Q', 'F', 'I', 0xfb}
+
+// isLocalConnection reports whether the connection is to the hypervisor on
+// this machine, so that paths it uses are paths here.
+func isLocalConnection(conn *libvirt.Connect) bool {
+	uri, err := conn.GetURI()
+	if err != nil {
+		log.Println("Failed to get connection URI:", err)
+		return false
+	}
+	parsed, err := url.Parse(uri)
+	if err != nil {
+		log.Println("Failed to parse connection URI:", err)
+		return false
+	}
+	return parsed.Host == ""
+}
+
+// detectDiskFormat asks libvirt for the format if path is a storage volume.
+// Otherwise it looks at the file itself, but only on a local connection, as
+// the path is on the hypervisor's host. If neither works the format has to
+// be chosen.
+func detectDiskFormat(conn *libvirt.Connect, path string) (string, error) {
+	if vol, err := conn.LookupStorageVolByPath(path); err == nil {
+		defer vol.Free()
+		if format, err := volumeFormat(vol); err != nil {
+			log.Println("Failed to get volume format:", err)
+		} else if format != "" {
+			return format, nil
+		}
+	}
+	if !isLocalConnection(conn) {
+		return "", fmt.Errorf("%s is no storage volume and the host is remote, choose the format", path)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("can't detect the format, choose it: %w", err)
+	}
+	defer file.Close()
+	magic := make([]byte, len(qcow2Magic))
+	if _, err := io.ReadFull(file, magic); err == nil && bytes.Equal(magic, qcow2Magic) {
+		return "qcow2", nil
+	}
+	return "raw", nil
+}
+
+// usedTargetDevs returns the target devs of every disk of the domain, live or
+// only in the persistent config.
+func usedTargetDevs(dom *libvirt.Domain) (map[string]bool, error) {
+	used := make(map[string]bool)
+	xmlFlags := []libvirt.DomainXMLFlags{0}
+	if persistent, err := dom.IsPersistent(); err == nil && persistent {
+		xmlFlags = append(xmlFlags, libvirt.DOMAIN_XML_INACTIVE)
+	}
+	for _, flags := range xmlFlags {
+		xmlDesc, err := dom.GetXMLDesc(flags)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get XML description: %w", err)
+		}
+		doc := etree.NewDocument()
+		if err := doc.ReadFromString(xmlDesc); err != nil {
+			return nil, fmt.Errorf("failed to parse XML: %w", err)
+		}
+		for _, target := range doc.FindElements("//devices/disk/target") {
+			used[target.SelectAttrValue("dev", "")] = true
+		}
+	}
+	return used, nil
+}
+
+// targetDevName returns the n-th dev name with the prefix: vda ... vdz,
+// vdaa, vdab, ...
+func targetDevName(prefix string, n int) string {
+	suffix := ""
+	for n++; n > 0; n = (n - 1) / 26 {
+		suffix = string(rune('a'+(n-1)%26)) + suffix
+	}
+	return prefix + suffix
+}
+
+// suggestTargetDev returns the first dev name for the bus that the domain
+// doesn't use yet.
+func suggestTargetDev(used map[string]bool, bus string) string {
+	prefix := "sd"
+	if bus == "virtio" {
+		prefix = "vd"
+	}
+	for n := 0; ; n++ {
+		if name := targetDevName(prefix, n); !used[name] {
+			return name
+		}
+	}
+}
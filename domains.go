@@ -0,0 +1,368 @@
+package main
+
+import (
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+	"libvirt.org/go/libvirt"
+)
+
+// domainEntry is a domain shown in the table. Entries are identified by UUID,
+// so renaming a domain keeps its row and its statistics.
+type domainEntry struct {
+	uuid  string
+	name  string
+	state libvirt.DomainState
+	dom   *libvirt.Domain
+	stats *StatProvider
+	// started is when we saw the domain start, zero if unknown. For domains
+	// already running when we connected it is the time we connected and
+	// runningAtLoad is set, the uptime is only a lower bound then.
+	started       time.Time
+	runningAtLoad bool
+
+	// statCells are the CPU, memory, I/O and network columns, rates the
+	// numbers behind them used for sorting
+	statCells [4]string
+	rates     [4]float64
+	addresses string
+	// marked entries are the targets of bulk actions
+	marked bool
+}
+
+// statsUpdate carries the results of one sample of a domain from the
+// refresher to the UI goroutine.
+type statsUpdate struct {
+	uuid  string
+	cells [4]string
+	rates [4]float64
+}
+
+const unsorted = -1
+
+// domainModel owns the rows of the domain table. It knows every domain in
+// entries and the filtered, sorted subset shown in the table in rows, row
+// i+1 of the table (row 0 is the header) belongs to rows[i]. It is only
+// modified from the UI goroutine, the mutex guards reads from the refresher.
+type domainModel struct {
+	mu         sync.Mutex
+	entries    []*domainEntry
+	rows       []*domainEntry
+	sortColumn int
+	sortDesc   bool
+	filter     domainFilter
+}
+
+func newDomainModel() *domainModel {
+	return &domainModel{sortColumn: unsorted}
+}
+
+func (m *domainModel) index(uuid string) int {
+	for i, entry := range m.entries {
+		if entry.uuid == uuid {
+			return i
+		}
+	}
+	return -1
+}
+
+// render fills the table with the filtered and sorted entries, keeping the
+// selection on the same domain. Must be called with the lock held.
+func (m *domainModel) render(table *tview.Table) {
+	selectedRow, _ := table.GetSelection()
+	var selectedUUID string
+	if selectedRow >= 1 && selectedRow <= len(m.rows) {
+		selectedUUID = m.rows[selectedRow-1].uuid
+	}
+
+	m.rows = m.rows[:0]
+	for _, entry := range m.entries {
+		if m.filter.matches(entry) {
+			m.rows = append(m.rows, entry)
+		}
+	}
+	if m.sortColumn != unsorted {
+		sort.SliceStable(m.rows, func(i, j int) bool {
+			if m.sortDesc {
+				return lessByColumn(m.rows[j], m.rows[i], m.sortColumn)
+			}
+			return lessByColumn(m.rows[i], m.rows[j], m.sortColumn)
+		})
+	}
+
+	for col, title := range columnTitles {
+		if col == m.sortColumn {
+			if m.sortDesc {
+				title += " ▼"
+			} else {
+				title += " ▲"
+			}
+		}
+		table.GetCell(0, col).SetText(" " + title + " ")
+	}
+
+	for i, entry := range m.rows {
+		name := entry.name
+		if entry.marked {
+			name = "* " + name
+		}
+		setCellSpaces(table, i+1, 0, name)
+		setCellSpaces(table, i+1, 1, humanState(entry.state))
+		if entry.state == libvirt.DOMAIN_SHUTOFF {
+			for j := 2; j < tableColumns; j++ {
+				table.SetCellSimple(i+1, j, "")
+			}
+		} else {
+			for j, text := range entry.statCells {
+				setCellSpaces(table, i+1, j+2, text)
+			}
+			setCellSpaces(table, i+1, 6, entry.addresses)
+		}
+		if entry.marked {
+			for j := 0; j < tableColumns; j++ {
+				table.GetCell(i+1, j).SetTextColor(tcell.ColorYellow)
+			}
+		}
+	}
+	for row := table.GetRowCount() - 1; row > len(m.rows); row-- {
+		table.RemoveRow(row)
+	}
+
+	newRow := selectedRow
+	for i, entry := range m.rows {
+		if entry.uuid == selectedUUID {
+			newRow = i + 1
+			break
+		}
+	}
+	if newRow > len(m.rows) {
+		newRow = len(m.rows)
+	}
+	if newRow < 1 {
+		newRow = 1
+	}
+	table.Select(newRow, 0)
+}
+
+// set adds the domain to the table or updates the name and state of its
+// existing row. The model takes ownership of dom.
+func (m *domainModel) set(table *tview.Table, dom *libvirt.Domain, uuid, name string, state libvirt.DomainState) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	i := m.index(uuid)
+	if i == -1 {
+		m.entries = append(m.entries, &domainEntry{uuid: uuid, dom: dom, stats: NewStatProvider()})
+		i = len(m.entries) - 1
+	} else {
+		dom.Free()
+	}
+	entry := m.entries[i]
+	entry.name = name
+	entry.state = state
+	if state == libvirt.DOMAIN_SHUTOFF || state == libvirt.DOMAIN_CRASHED {
+		entry.started = time.Time{}
+		entry.runningAtLoad = false
+	}
+	if state == libvirt.DOMAIN_SHUTOFF {
+		entry.statCells = [4]string{}
+		entry.rates = [4]float64{}
+		entry.addresses = ""
+	}
+	m.render(table)
+}
+
+// markStarted records the time the domain was started, used for its uptime.
+func (m *domainModel) markStarted(uuid string, at time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if i := m.index(uuid); i != -1 {
+		m.entries[i].started = at
+		m.entries[i].runningAtLoad = false
+	}
+}
+
+// markRunningAtLoad records that the domain was running when we connected.
+// libvirt has no start time of a domain, so its uptime counts from at.
+func (m *domainModel) markRunningAtLoad(uuid string, at time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if i := m.index(uuid); i != -1 {
+		m.entries[i].started = at
+		m.entries[i].runningAtLoad = true
+	}
+}
+
+// remove drops the row of the domain, shifting the rows below it up.
+func (m *domainModel) remove(table *tview.Table, uuid string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	i := m.index(uuid)
+	if i == -1 {
+		return
+	}
+	m.entries[i].dom.Free()
+	m.entries = append(m.entries[:i], m.entries[i+1:]...)
+	m.render(table)
+}
+
+// selected returns the entry of the selected table row. Must be called from
+// the UI goroutine.
+func (m *domainModel) selected(table *tview.Table) (*domainEntry, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	row, _ := table.GetSelection()
+	if row < 1 || row > len(m.rows) {
+		return nil, false
+	}
+	return m.rows[row-1], true
+}
+
+// toggleMark marks or unmarks the selected domain.
+func (m *domainModel) toggleMark(table *tview.Table) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	row, _ := table.GetSelection()
+	if row < 1 || row > len(m.rows) {
+		return
+	}
+	m.rows[row-1].marked = !m.rows[row-1].marked
+	m.render(table)
+}
+
+// markShown marks every domain matching the filter, or unmarks them if they
+// are all marked already.
+func (m *domainModel) markShown(table *tview.Table) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	allMarked := true
+	for _, entry := range m.rows {
+		allMarked = allMarked && entry.marked
+	}
+	for _, entry := range m.rows {
+		entry.marked = !allMarked
+	}
+	m.render(table)
+}
+
+// marked returns copies of the marked entries the filter shows, domains
+// hidden by the filter stay marked but aren't acted on. Every returned domain
+// is referenced and has to be released with Free by the caller.
+func (m *domainModel) marked() []domainEntry {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var entries []domainEntry
+	for _, entry := range m.rows {
+		if !entry.marked {
+			continue
+		}
+		if err := entry.dom.Ref(); err != nil {
+			log.Println("Failed to reference domain:", err)
+			continue
+		}
+		entries = append(entries, *entry)
+	}
+	return entries
+}
+
+// statProvider returns the StatProvider of the domain. The provider is only
+// used by the refresher goroutine.
+func (m *domainModel) statProvider(uuid string) (*StatProvider, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	i := m.index(uuid)
+	if i == -1 {
+		return nil, false
+	}
+	return m.entries[i].stats, true
+}
+
+// applyStats stores the sampled statistics of running domains and redraws
+// the table once for the whole batch.
+func (m *domainModel) applyStats(table *tview.Table, updates []statsUpdate) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, update := range updates {
+		i := m.index(update.uuid)
+		if i == -1 || m.entries[i].state == libvirt.DOMAIN_SHUTOFF {
+			continue
+		}
+		entry := m.entries[i]
+		entry.statCells = update.cells
+		entry.rates = update.rates
+	}
+	m.render(table)
+}
+
+// setAddresses stores the IP addresses of a running domain.
+func (m *domainModel) setAddresses(table *tview.Table, uuid, addresses string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	i := m.index(uuid)
+	if i == -1 || m.entries[i].state == libvirt.DOMAIN_SHUTOFF {
+		return
+	}
+	m.entries[i].addresses = addresses
+	m.render(table)
+}
+
+// sortBy sorts the table by the column, choosing the same column again
+// flips the direction.
+func (m *domainModel) sortBy(table *tview.Table, column int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.sortColumn == column {
+		m.sortDesc = !m.sortDesc
+	} else {
+		m.sortColumn = column
+		m.sortDesc = false
+	}
+	m.render(table)
+}
+
+func (m *domainModel) setFilter(table *tview.Table, filter domainFilter) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.filter = filter
+	m.render(table)
+}
+
+func (m *domainModel) filterText() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.filter.text
+}
+
+// loadDomains fills the table with the domains that exist at startup, later
+// changes are picked up from lifecycle events.
+func loadDomains(conn *libvirt.Connect, table *tview.Table, model *domainModel) error {
+	domainList, err := conn.ListAllDomains(0)
+	if err != nil {
+		return err
+	}
+	loadedAt := time.Now()
+	for _, domain := range domainList {
+		uuid, err := domain.GetUUIDString()
+		if err != nil {
+			log.Println("Failed to get domain UUID:", err)
+			domain.Free()
+			continue
+		}
+		name, err := domain.GetName()
+		if err != nil {
+			log.Println("Failed to get domain name:", err)
+		}
+		st, _, err := domain.GetState()
+		if err != nil {
+			log.Println("Failed to get domain state:", err)
+		}
+		model.set(table, &domain, uuid, name, st)
+		if st != libvirt.DOMAIN_SHUTOFF && st != libvirt.DOMAIN_CRASHED {
+			model.markRunningAtLoad(uuid, loadedAt)
+		}
+	}
+	return nil
+}
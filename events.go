@@ -0,0 +1,111 @@
+package main
+
+import (
+	"log"
+	"time"
+
+	"github.com/rivo/tview"
+	"libvirt.org/go/libvirt"
+)
+
+// startEventLoop registers the default libvirt event loop implementation and
+// keeps it running in the background. It has to be called before the
+// connection is opened, otherwise no events are delivered.
+func startEventLoop() error {
+	if err := libvirt.EventRegisterDefaultImpl(); err != nil {
+		return err
+	}
+	go func() {
+		for {
+			if err := libvirt.EventRunDefaultImpl(); err != nil {
+				log.Println("Failed to run event loop:", err)
+			}
+		}
+	}()
+	return nil
+}
+
+// eventState maps a lifecycle event to the state the domain ends up in.
+// The second return value is false when the state can't be derived from the
+// event alone (e.g. a domain was defined while already running).
+func eventState(event *libvirt.DomainEventLifecycle) (libvirt.DomainState, bool) {
+	switch event.Event {
+	case libvirt.DOMAIN_EVENT_STARTED, libvirt.DOMAIN_EVENT_RESUMED:
+		return libvirt.DOMAIN_RUNNING, true
+	case libvirt.DOMAIN_EVENT_SUSPENDED:
+		return libvirt.DOMAIN_PAUSED, true
+	case libvirt.DOMAIN_EVENT_STOPPED:
+		return libvirt.DOMAIN_SHUTOFF, true
+	case libvirt.DOMAIN_EVENT_SHUTDOWN:
+		return libvirt.DOMAIN_SHUTDOWN, true
+	case libvirt.DOMAIN_EVENT_PMSUSPENDED:
+		return libvirt.DOMAIN_PMSUSPENDED, true
+	case libvirt.DOMAIN_EVENT_CRASHED:
+		return libvirt.DOMAIN_CRASHED, true
+	default:
+		return libvirt.DOMAIN_NOSTATE, false
+	}
+}
+
+// registerLifecycleEvents keeps the domain model in sync with libvirt
+// lifecycle events. Only the row of the affected domain is touched.
+func registerLifecycleEvents(conn *libvirt.Connect, app *tview.Application, table *tview.Table, model *domainModel) (int, error) {
+	return conn.DomainEventLifecycleRegister(nil, func(c *libvirt.Connect, d *libvirt.Domain, event *libvirt.DomainEventLifecycle) {
+		uuid, err := d.GetUUIDString()
+		if err != nil {
+			log.Println("Failed to get domain UUID:", err)
+			return
+		}
+		name, err := d.GetName()
+		if err != nil {
+			log.Println("Failed to get domain name:", err)
+			return
+		}
+		log.Println("Lifecycle event for " + name + ": " + event.String())
+
+		switch event.Event {
+		case libvirt.DOMAIN_EVENT_UNDEFINED:
+			// a rename is followed by a defined event carrying the new name
+			if event.Detail == int(libvirt.DOMAIN_EVENT_UNDEFINED_RENAMED) {
+				return
+			}
+			// an undefined domain that is still running stays as transient
+			if state, _, err := d.GetState(); err == nil && state != libvirt.DOMAIN_SHUTOFF {
+				return
+			}
+			app.QueueUpdateDraw(func() {
+				model.remove(table, uuid)
+			})
+			return
+		case libvirt.DOMAIN_EVENT_STOPPED:
+			// transient domains disappear once they are stopped
+			if persistent, err := d.IsPersistent(); err == nil && !persistent {
+				app.QueueUpdateDraw(func() {
+					model.remove(table, uuid)
+				})
+				return
+			}
+		}
+
+		state, ok := eventState(event)
+		if !ok {
+			state, _, err = d.GetState()
+			if err != nil {
+				log.Println("Failed to get domain state:", err)
+				return
+			}
+		}
+		// the callback's domain is only valid until we return
+		if err := d.Ref(); err != nil {
+			log.Println("Failed to reference domain:", err)
+			return
+		}
+		receivedAt := time.Now()
+		app.QueueUpdateDraw(func() {
+			model.set(table, d, uuid, name, state)
+			if event.Event == libvirt.DOMAIN_EVENT_STARTED {
+				model.markStarted(uuid, receivedAt)
+			}
+		})
+	})
+}
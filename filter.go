@@ -0,0 +1,99 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// domainFilter narrows the table down to the matching domains. The zero
+// value matches everything.
+type domainFilter struct {
+	text  string
+	match func(entry *domainEntry) bool
+}
+
+func (f domainFilter) matches(entry *domainEntry) bool {
+	return f.match == nil || f.match(entry)
+}
+
+func normalizeState(state string) string {
+	return strings.ReplaceAll(strings.ToLower(state), " ", "")
+}
+
+// parseFilter understands "state:<state>" (e.g. state:running, state:shut
+// matches both shutting down and shut off), "re:<regexp>" matched against the
+// name and otherwise a case insensitive name substring.
+func parseFilter(text string) (domainFilter, error) {
+	text = strings.TrimSpace(text)
+	filter := domainFilter{text: text}
+	switch {
+	case text == "":
+		return domainFilter{}, nil
+	case strings.HasPrefix(text, "state:"):
+		state := normalizeState(strings.TrimPrefix(text, "state:"))
+		filter.match = func(entry *domainEntry) bool {
+			return strings.HasPrefix(normalizeState(humanState(entry.state)), state)
+		}
+	case strings.HasPrefix(text, "re:"):
+		re, err := regexp.Compile(strings.TrimPrefix(text, "re:"))
+		if err != nil {
+			return domainFilter{}, err
+		}
+		filter.match = func(entry *domainEntry) bool {
+			return re.MatchString(entry.name)
+		}
+	default:
+		substring := strings.ToLower(text)
+		filter.match = func(entry *domainEntry) bool {
+			return strings.Contains(strings.ToLower(entry.name), substring)
+		}
+	}
+	return filter, nil
+}
+
+// lessByColumn orders two entries by the values behind a table column.
+func lessByColumn(a, b *domainEntry, column int) bool {
+	switch column {
+	case 0:
+		return strings.ToLower(a.name) < strings.ToLower(b.name)
+	case 1:
+		return humanState(a.state) < humanState(b.state)
+	case 2, 3, 4, 5:
+		return a.rates[column-2] < b.rates[column-2]
+	default:
+		return a.addresses < b.addresses
+	}
+}
+
+// showFilterPrompt opens an input line at the bottom of the screen to edit
+// the table filter.
+func showFilterPrompt(pages *tview.Pages, table *tview.Table, model *domainModel) {
+	input := tview.NewInputField().
+		SetLabel("Filter (text, re:<regexp>, state:<state>): ").
+		SetText(model.filterText())
+	input.SetDoneFunc(func(key tcell.Key) {
+		if key == tcell.KeyEnter {
+			filter, err := parseFilter(input.GetText())
+			if err != nil {
+				setStatus("Invalid filter: " + err.Error())
+				return
+			}
+			model.setFilter(table, filter)
+			if filter.text == "" {
+				setStatus("Filter cleared")
+			} else {
+				setStatus("Filter: " + filter.text)
+			}
+		}
+		pages.RemovePage("Filter")
+	})
+
+	prompt := tview.NewFlex().
+		SetDirection(tview.FlexRow).
+		AddItem(nil, 0, 1, false).
+		AddItem(input, 1, 0, true)
+	pages.AddPage("Filter", prompt, true, true)
+}
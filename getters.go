@@ -3,133 +3,218 @@ package main
 import (
 	"errors"
 	"fmt"
-	"math"
+	"sync"
+	"time"
 
 	"github.com/dustin/go-humanize"
 	"libvirt.org/go/libvirt"
 )
 
+// counterSample is a reading of a cumulative counter and the time it was taken.
+type counterSample struct {
+	value uint64
+	at    time.Time
+}
+
+// rate returns the per-second increase of the counter since the previous
+// sample and stores the new one. ok is false for the first sample and when the
+// counter went backwards (e.g. the VM was restarted), in both cases the new
+// value only becomes the baseline for the next call.
+func (c *counterSample) rate(value uint64, at time.Time) (perSecond float64, ok bool) {
+	prev := *c
+	*c = counterSample{value: value, at: at}
+	if prev.at.IsZero() || value < prev.value {
+		return 0, false
+	}
+	elapsed := at.Sub(prev.at).Seconds()
+	if elapsed <= 0 {
+		return 0, false
+	}
+	return float64(value-prev.value) / elapsed, true
+}
+
+// historyWindow is how far back the rate history of a domain reaches.
+const historyWindow = 5 * time.Minute
+
+type historyPoint struct {
+	at    time.Time
+	value float64
+}
+
+type history []historyPoint
+
+// add appends a value and drops the ones that fell out of the history window.
+func (h *history) add(value float64, at time.Time) {
+	*h = append(*h, historyPoint{at: at, value: value})
+	drop := 0
+	for drop < len(*h) && at.Sub((*h)[drop].at) > historyWindow {
+		drop++
+	}
+	*h = (*h)[drop:]
+}
+
+func (h history) values() []float64 {
+	values := make([]float64, len(h))
+	for i, point := range h {
+		values[i] = point.value
+	}
+	return values
+}
+
+// statHistory is a copy of the recent rates of a domain: CPU in percent,
+// memory in bytes used, disk and network in bytes per second.
+type statHistory struct {
+	cpu     []float64
+	memory  []float64
+	disk    []float64
+	network []float64
+}
+
 type prevStats struct {
-	cpuTime uint64
-	rdBytes int64
-	wrBytes int64
-	rxBytes int64
-	txBytes int64
+	cpuTime counterSample
+	rdBytes counterSample
+	wrBytes counterSample
+	rxBytes counterSample
+	txBytes counterSample
+	devices *deviceSamples
 }
 
-// StatProvider provides methods for retrieving various statistics from a libvirt domain.
+// statsTypes are the stat groups requested from GetAllDomainStats, covering
+// everything StatProvider needs.
+const statsTypes = libvirt.DOMAIN_STATS_STATE |
+	libvirt.DOMAIN_STATS_CPU_TOTAL |
+	libvirt.DOMAIN_STATS_BALLOON |
+	libvirt.DOMAIN_STATS_VCPU |
+	libvirt.DOMAIN_STATS_INTERFACE |
+	libvirt.DOMAIN_STATS_BLOCK
+
+// StatProvider computes usage statistics from consecutive domain stats records
+// and keeps a short history of them.
 type StatProvider struct {
-	dom    *libvirt.Domain
 	prevSt *prevStats
+
+	mu          sync.Mutex
+	cpuHist     history
+	memHist     history
+	diskHist    history
+	networkHist history
+	latest      breakdown
 }
 
-// NewStatProvider creates a new instance of StatsProvider with the given libvirt.Domain.
+// NewStatProvider creates a new instance of StatsProvider.
 // It initializes the StatsProvider with an empty prevStats struct.
-func NewStatProvider(dom *libvirt.Domain) *StatProvider {
+func NewStatProvider() *StatProvider {
 	return &StatProvider{
-		dom:    dom,
 		prevSt: &prevStats{},
 	}
 }
 
-func (sp *StatProvider) getCPUUsage(sleepTime uint64) (string, error) {
-	info, err := sp.dom.GetInfo()
-	if err != nil {
-		return "", err
-	}
-	numCores := info.NrVirtCpu
+// reset drops the previous samples, so the next rates are computed from a
+// fresh baseline.
+func (sp *StatProvider) reset() {
+	sp.prevSt = &prevStats{}
+}
 
-	cpuStats, err := sp.dom.GetCPUStats(-1, 1, 0)
-	if err != nil {
-		return "", err
+// history returns a copy of the recorded rates, safe to use from any goroutine.
+func (sp *StatProvider) history() statHistory {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	return statHistory{
+		cpu:     sp.cpuHist.values(),
+		memory:  sp.memHist.values(),
+		disk:    sp.diskHist.values(),
+		network: sp.networkHist.values(),
 	}
-	var cpuUsage float64 = 0
-	if sp.prevSt.cpuTime == 0 {
-		sp.prevSt.cpuTime = cpuStats[0].CpuTime
-	} else {
-		cpuUsage = float64(cpuStats[0].CpuTime-sp.prevSt.cpuTime) / float64(sleepTime*1000000000) * 100 / float64(numCores)
-		if cpuUsage > 100 {
-			cpuUsage = 100
+}
+
+// latestRates returns the last recorded CPU, memory, disk and network values.
+func (sp *StatProvider) latestRates() [4]float64 {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	var rates [4]float64
+	for i, h := range []history{sp.cpuHist, sp.memHist, sp.diskHist, sp.networkHist} {
+		if len(h) > 0 {
+			rates[i] = h[len(h)-1].value
 		}
-		sp.prevSt.cpuTime = cpuStats[0].CpuTime
 	}
-	return fmt.Sprintf("%.2f%%", cpuUsage), nil
+	return rates
 }
 
-func (sp *StatProvider) getDiskStats(sleepTime uint64) (string, error) {
-	diskStats, err := sp.dom.BlockStats("")
-	if err != nil {
-		return "", err
-	}
+func (sp *StatProvider) record(h *history, value float64, at time.Time) {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	h.add(value, at)
+}
 
-	if sp.prevSt.rdBytes == 0 && sp.prevSt.wrBytes == 0 {
-		sp.prevSt.rdBytes = diskStats.RdBytes
-		sp.prevSt.wrBytes = diskStats.WrBytes
-		return "", nil
+func (sp *StatProvider) getCPUUsage(stats *libvirt.DomainStats, at time.Time) (string, error) {
+	if stats.Cpu == nil || !stats.Cpu.TimeSet {
+		return "", errors.New("cpu time not available")
+	}
+	numCores := 0
+	for _, vcpu := range stats.Vcpu {
+		if vcpu.State != libvirt.VCPU_OFFLINE {
+			numCores++
+		}
+	}
+	if numCores == 0 {
+		return "", errors.New("vcpu count not available")
 	}
 
-	ioReadPerSecond := uint64(diskStats.RdBytes-sp.prevSt.rdBytes) / sleepTime
-	ioWritePerSecond := uint64(diskStats.WrBytes-sp.prevSt.wrBytes) / sleepTime
-	sp.prevSt.rdBytes = diskStats.RdBytes
-	sp.prevSt.wrBytes = diskStats.WrBytes
-	return humanize.IBytes(ioReadPerSecond) + " / " + humanize.IBytes(ioWritePerSecond), nil
-
+	cpuNsPerSecond, ok := sp.prevSt.cpuTime.rate(stats.Cpu.Time, at)
+	cpuUsage := cpuNsPerSecond / 1e9 * 100 / float64(numCores)
+	if cpuUsage > 100 {
+		cpuUsage = 100
+	}
+	if ok {
+		sp.record(&sp.cpuHist, cpuUsage, at)
+	}
+	return fmt.Sprintf("%.2f%%", cpuUsage), nil
 }
 
-func (sp *StatProvider) getMemoryStats() (string, error) {
-
-	memStats, err := sp.dom.MemoryStats(math.MaxUint16, 0)
-	if err != nil {
-		return "", err
+func (sp *StatProvider) getDiskStats(stats *libvirt.DomainStats, at time.Time) (string, error) {
+	var rdBytes, wrBytes uint64
+	for _, block := range stats.Block {
+		rdBytes += block.RdBytes
+		wrBytes += block.WrBytes
 	}
 
-	var totalMemory, unusedMemory uint64
-	totalMemorySet, unusedMemorySet := false, false
-
-	for _, stat := range memStats {
-		switch stat.Tag {
-		case int32(libvirt.DOMAIN_MEMORY_STAT_ACTUAL_BALLOON):
-			totalMemory = stat.Val
-			totalMemorySet = true
-		case int32(libvirt.DOMAIN_MEMORY_STAT_UNUSED):
-			unusedMemory = stat.Val
-			unusedMemorySet = true
-		}
+	ioReadPerSecond, rdOk := sp.prevSt.rdBytes.rate(rdBytes, at)
+	ioWritePerSecond, wrOk := sp.prevSt.wrBytes.rate(wrBytes, at)
+	if !rdOk || !wrOk {
+		return "", nil
 	}
+	sp.record(&sp.diskHist, ioReadPerSecond+ioWritePerSecond, at)
+	return humanize.IBytes(uint64(ioReadPerSecond)) + " / " + humanize.IBytes(uint64(ioWritePerSecond)), nil
+
+}
 
-	if !totalMemorySet || !unusedMemorySet {
+func (sp *StatProvider) getMemoryStats(stats *libvirt.DomainStats, at time.Time) (string, error) {
+	balloon := stats.Balloon
+	if balloon == nil || !balloon.CurrentSet || !balloon.UnusedSet {
 		return "", errors.New("required memory stats not available")
 	}
 
-	usedMemory := totalMemory - unusedMemory
+	totalMemory := balloon.Current
+	usedMemory := totalMemory - balloon.Unused
+	sp.record(&sp.memHist, float64(usedMemory*1024), at)
 	return humanize.IBytes(usedMemory*1024) + " / " + humanize.IBytes(totalMemory*1024), nil
 }
 
-func (sp *StatProvider) getNetworkStats(sleepTime uint64) (string, error) {
+func (sp *StatProvider) getNetworkStats(stats *libvirt.DomainStats, at time.Time) (string, error) {
 	netRxPerSecond := "0"
 	netTxPerSecond := "0"
-	ifAddr, err := sp.dom.ListAllInterfaceAddresses(0)
-	if err != nil {
-		return "", err
-	}
-	var rxBytes int64 = 0
-	var txBytes int64 = 0
-	for _, iface := range ifAddr {
-		netStats, err := sp.dom.InterfaceStats(iface.Name)
-		if err != nil {
-			return "", err
-		}
-		rxBytes += netStats.RxBytes
-		txBytes += netStats.TxBytes
-	}
-	if sp.prevSt.rxBytes == 0 && sp.prevSt.txBytes == 0 {
-		sp.prevSt.rxBytes = rxBytes
-		sp.prevSt.txBytes = txBytes
-	} else {
-		netRxPerSecond = humanize.IBytes(uint64(rxBytes-sp.prevSt.rxBytes) / sleepTime)
-		netTxPerSecond = humanize.IBytes(uint64(txBytes-sp.prevSt.txBytes) / sleepTime)
-		sp.prevSt.rxBytes = rxBytes
-		sp.prevSt.txBytes = txBytes
+	var rxBytes uint64 = 0
+	var txBytes uint64 = 0
+	for _, iface := range stats.Net {
+		rxBytes += iface.RxBytes
+		txBytes += iface.TxBytes
+	}
+	rxRate, rxOk := sp.prevSt.rxBytes.rate(rxBytes, at)
+	txRate, txOk := sp.prevSt.txBytes.rate(txBytes, at)
+	if rxOk && txOk {
+		netRxPerSecond = humanize.IBytes(uint64(rxRate))
+		netTxPerSecond = humanize.IBytes(uint64(txRate))
+		sp.record(&sp.networkHist, rxRate+txRate, at)
 	}
 	return netRxPerSecond + " / " + netTxPerSecond, nil
 }
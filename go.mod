@@ -3,6 +3,7 @@ module radimous/virt-man-tui
 go 1.22.1
 
 require (
+	github.com/BurntSushi/toml v1.4.0
 	github.com/beevik/etree v1.4.0
 	github.com/dustin/go-humanize v1.0.1
 	github.com/gdamore/tcell/v2 v2.7.1
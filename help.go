@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+	"libvirt.org/go/libvirt"
+)
+
+// builtinKeys are the keys of the table itself, they can't be rebound.
+var builtinKeys = [][2]string{
+	{"+/-", "Make the statistics refresh faster or slower"},
+	{"p", "Pause the statistics"},
+	{"Enter", "Show the details of the VM"},
+	{"a", "Switch the source of IP addresses"},
+	{"1-6", "Sort by a column, again to reverse"},
+	{"/", "Filter the VMs"},
+	{"Space", "Mark the VM for actions on several VMs"},
+	{"*", "Mark every shown VM"},
+	{"r", "Show the results of the last action on several VMs"},
+	{"J", "Show the jobs"},
+	{"S", "Browse storage pools and volumes"},
+	{"N", "Manage virtual networks and see their DHCP leases"},
+	{":", "Run any action by name"},
+	{"?", "Show this help"},
+}
+
+// actionKeys returns the keys bound to the action, e.g. "^G/F2".
+func actionKeys(id string, bindings map[keyBinding]string) string {
+	var keys []string
+	for key, boundID := range bindings {
+		if boundID == id {
+			keys = append(keys, key.String())
+		}
+	}
+	sort.Strings(keys)
+	return strings.Join(keys, "/")
+}
+
+// keybindsBar is the bottom bar listing the bound actions that apply to the
+// selected domain, two per column.
+type keybindsBar struct {
+	grid     *tview.Grid
+	actions  map[string]Action
+	bindings map[keyBinding]string
+	// state the bar was last rendered for, hasState is false without a
+	// selected domain
+	state    libvirt.DomainState
+	hasState bool
+	rendered bool
+}
+
+func newKeybindsBar(actions map[string]Action, bindings map[keyBinding]string) *keybindsBar {
+	bar := &keybindsBar{grid: tview.NewGrid().SetBorders(false), actions: actions, bindings: bindings}
+	bar.grid.SetRows(1, 1)
+	return bar
+}
+
+// update renders the bar for the selected domain if its state changed since
+// the last call.
+func (b *keybindsBar) update(entry *domainEntry, ok bool) {
+	var state libvirt.DomainState
+	if ok {
+		state = entry.state
+	}
+	if b.rendered && ok == b.hasState && state == b.state {
+		return
+	}
+	b.rendered, b.hasState, b.state = true, ok, state
+
+	var labels []string
+	for _, id := range actionOrder {
+		keys := actionKeys(id, b.bindings)
+		if keys == "" || !ok || !b.actions[id].ValidIn(state) {
+			continue
+		}
+		labels = append(labels, keys+": "+b.actions[id].Label())
+	}
+	labels = append(labels, ":: Commands", "?: Help")
+
+	b.grid.Clear()
+	b.grid.SetColumns(make([]int, (len(labels)+1)/2)...)
+	for i, label := range labels {
+		b.grid.AddItem(transparentTextView(label), i%2, i/2, 1, 1, 0, 0, false)
+	}
+}
+
+// createHelpView lists every action and builtin key. Actions that don't apply
+// to the selected domain are dimmed.
+func createHelpView(pages *tview.Pages, actions map[string]Action, bindings map[keyBinding]string, selected *domainEntry) *tview.Grid {
+	table := tview.NewTable().
+		SetBorders(false).
+		SetSelectable(true, false).
+		SetFixed(1, 0)
+	table.SetBackgroundColor(tcell.ColorDefault)
+	title := "Help"
+	if selected != nil {
+		title += " (dimmed actions are not possible while " + selected.name + " is " + strings.ToLower(humanState(selected.state)) + ")"
+	}
+	table.SetBorder(true).SetTitle(title).SetTitleAlign(tview.AlignLeft)
+	for col, title := range []string{"Key", "Action", "Description"} {
+		setCellSpaces(table, 0, col, title)
+		table.GetCell(0, col).SetBackgroundColor(tcell.ColorDarkMagenta).SetSelectable(false)
+	}
+
+	row := 1
+	for _, id := range actionOrder {
+		action := actions[id]
+		description := action.Description()
+		if action.Dangerous() {
+			description += " (asks for confirmation)"
+		}
+		setCellSpaces(table, row, 0, actionKeys(id, bindings))
+		setCellSpaces(table, row, 1, fmt.Sprintf(":%s", id))
+		setCellSpaces(table, row, 2, description)
+		if selected != nil && !action.ValidIn(selected.state) {
+			for col := 0; col < 3; col++ {
+				table.GetCell(row, col).SetTextColor(tcell.ColorGray)
+			}
+		}
+		row++
+	}
+	for _, key := range builtinKeys {
+		setCellSpaces(table, row, 0, key[0])
+		setCellSpaces(table, row, 2, key[1])
+		row++
+	}
+
+	helpGrid := tview.NewGrid().
+		SetRows(0, 1).
+		SetColumns(0).
+		SetBorders(false).
+		AddItem(table, 0, 0, 1, 1, 0, 0, true).
+		AddItem(statusView, 1, 0, 1, 1, 0, 0, false)
+	helpGrid.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if event.Key() == tcell.KeyEscape || event.Rune() == 'q' || event.Rune() == '?' {
+			pages.SwitchToPage("MainTable")
+			pages.RemovePage("Help")
+			return nil
+		}
+		return event
+	})
+	return helpGrid
+}
+
+func showHelp(pages *tview.Pages, actions map[string]Action, bindings map[keyBinding]string, selected *domainEntry) {
+	pages.AddPage("Help", createHelpView(pages, actions, bindings, selected), true, false)
+	pages.SwitchToPage("Help")
+}
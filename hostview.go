@@ -0,0 +1,127 @@
+package main
+
+import (
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+	"libvirt.org/go/libvirt"
+)
+
+// hostView is what the pages for objects of the host, like storage pools and
+// networks, have in common. Their actions run on the job queue and their
+// forms return to the page.
+type hostView struct {
+	app   *tview.Application
+	pages *tview.Pages
+	conn  *libvirt.Connect
+	jobs  *jobQueue
+	// page is the name of the page
+	page string
+	// reload is called once an action finished
+	reload func()
+}
+
+// selectionLoadDelay lets the cursor move on before what belongs to the
+// selected object, like the volumes of a pool, is listed. Scrolling over the
+// objects then doesn't list it for every one of them.
+const selectionLoadDelay = 200 * time.Millisecond
+
+// background runs fetch off the UI goroutine, listing host objects can take
+// many calls on a remote connection. The function fetch returns is applied
+// on the UI goroutine.
+func (h *hostView) background(fetch func() (apply func())) {
+	go func() {
+		apply := fetch()
+		h.app.QueueUpdateDraw(apply)
+	}()
+}
+
+func newListTable(title string) *tview.Table {
+	table := tview.NewTable().
+		SetBorders(false).
+		SetSeparator(tview.Borders.Vertical).
+		SetSelectable(true, false).
+		SetFixed(1, 0)
+	table.SetBackgroundColor(tcell.ColorDefault)
+	table.SetBorder(true).SetTitle(title).SetTitleAlign(tview.AlignLeft)
+	return table
+}
+
+func setListHeader(table *tview.Table, titles []string) {
+	table.Clear()
+	for col, title := range titles {
+		setCellSpaces(table, 0, col, title)
+		table.GetCell(0, col).SetBackgroundColor(tcell.ColorDarkMagenta).SetSelectable(false)
+	}
+}
+
+// hostAction wraps fn as an action for the job queue, it doesn't work on a
+// domain.
+func hostAction(label, start, success, fail string, dangerous bool, fn func() error) SimpleAction {
+	return NewSimpleAction(Meta{label: label, dangerous: dangerous}, start, success, fail, func(*libvirt.Domain) error {
+		return fn()
+	})
+}
+
+// submit queues the action on the named target and reloads the page once it
+// finished, asking first if the action is dangerous.
+func (h *hostView) submit(action Action, target string) {
+	run := func() {
+		setStatus(action.StartMessage() + " " + target)
+		h.jobs.submit(action, nil, target, func(err error) {
+			if err != nil {
+				setStatus(action.FailMessage() + " " + target + ". " + libvirtError(err))
+			} else {
+				setStatus("Successfully " + action.SuccessMessage() + " " + target)
+			}
+			h.reload()
+		})
+	}
+	if action.Dangerous() {
+		confirmAction(h.pages, action, []string{target}, run, func() {})
+		return
+	}
+	run()
+}
+
+func (h *hostView) closeForm() {
+	h.pages.SwitchToPage(h.page)
+	h.pages.RemovePage(h.page + "Form")
+}
+
+// showForm asks for the labeled values, prefilled with the defaults, and
+// submits the action that build returns for them on its target. The form
+// stays open if build fails.
+func (h *hostView) showForm(title string, labels, defaults []string, build func(values []string) (action SimpleAction, target string, err error)) {
+	form := tview.NewForm()
+	for i, label := range labels {
+		form.AddInputField(label, defaults[i], 50, nil, nil)
+	}
+	form.
+		AddButton("Submit", func() {
+			values := make([]string, len(labels))
+			for i, label := range labels {
+				values[i] = form.GetFormItemByLabel(label).(*tview.InputField).GetText()
+			}
+			action, target, err := build(values)
+			if err != nil {
+				setStatus(err.Error())
+				return
+			}
+			h.closeForm()
+			h.submit(action, target)
+		}).
+		AddButton("Cancel", h.closeForm)
+	form.SetBorder(true).SetTitle(title).SetTitleAlign(tview.AlignLeft)
+	form.SetCancelFunc(h.closeForm)
+
+	formGrid := tview.NewGrid().
+		SetRows(0, 1).
+		SetColumns(0).
+		SetBorders(false).
+		AddItem(form, 0, 0, 1, 1, 0, 0, true).
+		AddItem(statusView, 1, 0, 1, 1, 0, 0, false)
+	h.pages.AddPage(h.page+"Form", formGrid, true, false)
+	h.pages.SwitchToPage(h.page + "Form")
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/beevik/etree"
+	"libvirt.org/go/libvirt"
+)
+
+var addressSources = []struct {
+	name   string
+	source libvirt.DomainInterfaceAddressesSource
+}{
+	{"lease", libvirt.DOMAIN_INTERFACE_ADDRESSES_SRC_LEASE},
+	{"agent", libvirt.DOMAIN_INTERFACE_ADDRESSES_SRC_AGENT},
+	{"arp", libvirt.DOMAIN_INTERFACE_ADDRESSES_SRC_ARP},
+}
+
+func parseAddressSource(name string) (libvirt.DomainInterfaceAddressesSource, error) {
+	for _, src := range addressSources {
+		if src.name == name {
+			return src.source, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown address source %q, expected lease, agent or arp", name)
+}
+
+func addressSourceName(source libvirt.DomainInterfaceAddressesSource) string {
+	for _, src := range addressSources {
+		if src.source == source {
+			return src.name
+		}
+	}
+	return "unknown"
+}
+
+type Interface struct {
+	MAC    string
+	Type   string
+	Source string
+	Model  string
+	Target string
+	IPs    []string
+}
+
+// createInterfaceList returns the NICs of the domain XML read with xmlFlags,
+// DOMAIN_XML_INACTIVE for the persistent config.
+func createInterfaceList(dom *libvirt.Domain, xmlFlags libvirt.DomainXMLFlags) ([]Interface, error) {
+	var interfaces []Interface
+
+	xmlDesc, err := dom.GetXMLDesc(xmlFlags)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get XML description: %w", err)
+	}
+	doc := etree.NewDocument()
+	if err := doc.ReadFromString(xmlDesc); err != nil {
+		return nil, fmt.Errorf("failed to parse XML: %w", err)
+	}
+	for _, iface := range doc.FindElements("//devices/interface") {
+		nic := Interface{Type: iface.SelectAttrValue("type", "")}
+		if mac := iface.SelectElement("mac"); mac != nil {
+			nic.MAC = strings.ToLower(mac.SelectAttrValue("address", ""))
+		}
+		if source := iface.SelectElement("source"); source != nil {
+			for _, attr := range []string{"network", "bridge", "dev"} {
+				if value := source.SelectAttrValue(attr, ""); value != "" {
+					nic.Source = value
+					break
+				}
+			}
+		}
+		if model := iface.SelectElement("model"); model != nil {
+			nic.Model = model.SelectAttrValue("type", "")
+		}
+		if target := iface.SelectElement("target"); target != nil {
+			nic.Target = target.SelectAttrValue("dev", "")
+		}
+		interfaces = append(interfaces, nic)
+	}
+
+	return interfaces, nil
+}
+
+// fillInterfaceAddresses adds the IP addresses known to libvirt to the
+// interfaces, matched by MAC address.
+func fillInterfaceAddresses(dom *libvirt.Domain, interfaces []Interface, source libvirt.DomainInterfaceAddressesSource) error {
+	addresses, err := dom.ListAllInterfaceAddresses(source)
+	if err != nil {
+		return err
+	}
+	for _, address := range addresses {
+		for i := range interfaces {
+			if interfaces[i].MAC != strings.ToLower(address.Hwaddr) {
+				continue
+			}
+			for _, addr := range address.Addrs {
+				interfaces[i].IPs = append(interfaces[i].IPs, fmt.Sprintf("%s/%d", addr.Addr, addr.Prefix))
+			}
+		}
+	}
+	return nil
+}
+
+// domainAddresses lists the IP addresses of the NICs defined in the domain
+// XML. Addresses of interfaces the domain XML doesn't know about (e.g. guest
+// internal bridges reported by the agent) and loopback addresses are left out.
+func domainAddresses(dom *libvirt.Domain, source libvirt.DomainInterfaceAddressesSource) (string, error) {
+	interfaces, err := createInterfaceList(dom, 0)
+	if err != nil {
+		return "", err
+	}
+	if err := fillInterfaceAddresses(dom, interfaces, source); err != nil {
+		return "", err
+	}
+	var ips []string
+	for _, nic := range interfaces {
+		for _, ip := range nic.IPs {
+			addr, _, _ := strings.Cut(ip, "/")
+			if parsed := net.ParseIP(addr); parsed != nil && (parsed.IsLoopback() || parsed.IsLinkLocalUnicast()) {
+				continue
+			}
+			ips = append(ips, addr)
+		}
+	}
+	return strings.Join(ips, ", "), nil
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+	"libvirt.org/go/libvirt"
+)
+
+// maxFinishedJobs is how many finished jobs are kept for the jobs panel.
+const maxFinishedJobs = 100
+
+type job struct {
+	id       int
+	action   Action
+	vmName   string
+	dom      *libvirt.Domain
+	queued   time.Time
+	started  time.Time
+	finished time.Time
+	err      error
+	done     func(err error)
+}
+
+func (j *job) stateText() string {
+	switch {
+	case j.started.IsZero():
+		return "queued"
+	case j.finished.IsZero():
+		return "running"
+	case j.err != nil:
+		return "failed"
+	default:
+		return "done"
+	}
+}
+
+func (j *job) elapsed() time.Duration {
+	switch {
+	case j.started.IsZero():
+		return 0
+	case j.finished.IsZero():
+		return time.Since(j.started).Truncate(time.Second)
+	default:
+		return j.finished.Sub(j.started).Truncate(time.Millisecond)
+	}
+}
+
+// jobQueue runs actions on a fixed number of worker goroutines, so slow
+// libvirt calls don't block the UI.
+type jobQueue struct {
+	mu     sync.Mutex
+	jobs   []*job
+	nextID int
+	queue  chan *job
+	app    *tview.Application
+}
+
+func newJobQueue(app *tview.Application, workers int) *jobQueue {
+	q := &jobQueue{queue: make(chan *job, 1024), app: app}
+	if workers < 1 {
+		workers = 1
+	}
+	for i := 0; i < workers; i++ {
+		go q.worker()
+	}
+	return q
+}
+
+func (q *jobQueue) worker() {
+	for j := range q.queue {
+		q.mu.Lock()
+		j.started = time.Now()
+		q.mu.Unlock()
+
+		err := j.action.Execute(j.dom)
+		if j.dom != nil {
+			j.dom.Free()
+		}
+		if err != nil {
+			log.Println(j.action.FailMessage()+" domain:", err)
+		} else {
+			log.Println("Successfully " + j.action.SuccessMessage() + " " + j.vmName)
+		}
+
+		q.mu.Lock()
+		j.finished = time.Now()
+		j.err = err
+		q.mu.Unlock()
+		if j.done != nil {
+			q.app.QueueUpdateDraw(func() {
+				j.done(err)
+			})
+		}
+	}
+}
+
+// submit queues the action for the domain. The queue takes ownership of dom,
+// which is nil for actions on something else than a domain, e.g. a storage
+// volume named by vmName. done is called on the UI goroutine once the action
+// finished.
+func (q *jobQueue) submit(action Action, dom *libvirt.Domain, vmName string, done func(err error)) {
+	q.mu.Lock()
+	q.nextID++
+	j := &job{id: q.nextID, action: action, vmName: vmName, dom: dom, queued: time.Now(), done: done}
+	q.jobs = append(q.jobs, j)
+	q.prune()
+	q.mu.Unlock()
+	q.queue <- j
+}
+
+// submitDomainJob queues the action for a domain the caller keeps, the job
+// takes its own reference. The outcome is shown in the status bar, done is
+// called after that unless it is nil.
+func submitDomainJob(jobs *jobQueue, action Action, dom *libvirt.Domain, vmName string, done func(err error)) {
+	if err := dom.Ref(); err != nil {
+		log.Println("Failed to reference domain:", err)
+		return
+	}
+	setStatus(action.StartMessage() + " " + vmName)
+	jobs.submit(action, dom, vmName, func(err error) {
+		if err != nil {
+			setStatus(action.FailMessage() + " " + vmName + ". " + libvirtError(err))
+		} else {
+			setStatus("Successfully " + action.SuccessMessage() + " " + vmName)
+		}
+		if done != nil {
+			done(err)
+		}
+	})
+}
+
+// prune drops the oldest finished jobs above maxFinishedJobs. Must be called
+// with the lock held.
+func (q *jobQueue) prune() {
+	finished := 0
+	for _, j := range q.jobs {
+		if !j.finished.IsZero() {
+			finished++
+		}
+	}
+	kept := q.jobs[:0]
+	for _, j := range q.jobs {
+		if !j.finished.IsZero() && finished > maxFinishedJobs {
+			finished--
+			continue
+		}
+		kept = append(kept, j)
+	}
+	q.jobs = kept
+}
+
+func (q *jobQueue) render(table *tview.Table) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	table.Clear()
+	for col, title := range []string{"ID", "Action", "Target", "State", "Elapsed", "Error"} {
+		setCellSpaces(table, 0, col, title)
+		table.GetCell(0, col).SetBackgroundColor(tcell.ColorDarkMagenta).SetSelectable(false)
+	}
+	// newest first
+	for i := len(q.jobs) - 1; i >= 0; i-- {
+		j := q.jobs[i]
+		row := len(q.jobs) - i
+		errText := ""
+		if j.err != nil {
+			errText = libvirtError(j.err)
+		}
+		setCellSpaces(table, row, 0, fmt.Sprint(j.id))
+		setCellSpaces(table, row, 1, j.action.StartMessage())
+		setCellSpaces(table, row, 2, j.vmName)
+		setCellSpaces(table, row, 3, j.stateText())
+		setCellSpaces(table, row, 4, j.elapsed().String())
+		setCellSpaces(table, row, 5, errText)
+	}
+}
+
+func createJobsGrid(app *tview.Application, pages *tview.Pages, jobs *jobQueue) *tview.Grid {
+	table := tview.NewTable().
+		SetBorders(false).
+		SetSeparator(tview.Borders.Vertical).
+		SetSelectable(true, false).
+		SetFixed(1, 0)
+	table.SetBackgroundColor(tcell.ColorDefault)
+	table.SetBorder(true).SetTitle("Jobs").SetTitleAlign(tview.AlignLeft)
+	jobs.render(table)
+
+	stop := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				app.QueueUpdateDraw(func() {
+					jobs.render(table)
+				})
+			}
+		}
+	}()
+
+	jobsGrid := tview.NewGrid().
+		SetRows(0, 1).
+		SetColumns(0).
+		SetBorders(false).
+		AddItem(table, 0, 0, 1, 1, 0, 0, true).
+		AddItem(statusView, 1, 0, 1, 1, 0, 0, false)
+	jobsGrid.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if event.Key() == tcell.KeyEscape || event.Rune() == 'q' {
+			close(stop)
+			pages.SwitchToPage("MainTable")
+			pages.RemovePage("Jobs")
+			return nil
+		}
+		return event
+	})
+	return jobsGrid
+}
+
+func showJobs(app *tview.Application, pages *tview.Pages, jobs *jobQueue) {
+	pages.AddPage("Jobs", createJobsGrid(app, pages, jobs), true, false)
+	pages.SwitchToPage("Jobs")
+}
@@ -1,8 +1,10 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"log"
+	"strings"
 
 	"github.com/gdamore/tcell/v2"
 	"github.com/rivo/tview"
@@ -16,28 +18,158 @@ func libvirtError(err error) string {
 	return err.Error()
 }
 
-func handleKeypress(conn *libvirt.Connect, table *tview.Table, event *tcell.EventKey, actions map[tcell.Key]Action) *tcell.EventKey {
-	row, _ := table.GetSelection()
-	vmName := table.GetCell(row, 0).Text
-	if len(vmName) < 2 {
-		return event
+// handleRefreshKeys changes the statistics sampling with + (faster), - (slower)
+// and p (pause), a switches the source of IP addresses. It returns true if the
+// key was consumed.
+func handleRefreshKeys(rc *refreshControl, event *tcell.EventKey) bool {
+	switch event.Rune() {
+	case '+':
+		setStatus("Refresh interval set to " + rc.faster().String())
+	case '-':
+		setStatus("Refresh interval set to " + rc.slower().String())
+	case 'p':
+		if rc.togglePause() {
+			setStatusIndicator("paused")
+			setStatus("Statistics paused")
+		} else {
+			setStatusIndicator("")
+			setStatus("Statistics resumed")
+		}
+	case 'a':
+		setStatus("IP addresses from " + addressSourceName(rc.nextAddressSource()))
+	default:
+		return false
+	}
+	return true
+}
+
+// handleTableKeys sorts the table with 1-6 (pressing the same number again
+// reverses the order), opens the filter prompt with /, marks domains with
+// space and * (everything matching the filter) and shows the results of the
+// last bulk action with r. It returns true if the key was consumed.
+func handleTableKeys(pages *tview.Pages, table *tview.Table, model *domainModel, event *tcell.EventKey) bool {
+	switch r := event.Rune(); {
+	case r >= '1' && r <= '6':
+		model.sortBy(table, int(r-'1'))
+	case r == '/':
+		showFilterPrompt(pages, table, model)
+	case r == ' ':
+		model.toggleMark(table)
+		row, _ := table.GetSelection()
+		if row < table.GetRowCount()-1 {
+			table.Select(row+1, 0)
+		}
+	case r == '*':
+		model.markShown(table)
+	case r == 'r':
+		showBulkResults(pages)
+	default:
+		return false
 	}
-	vmName = vmName[1 : len(vmName)-1]
-	dom, err := conn.LookupDomainByName(vmName)
-	if err != nil {
-		log.Println("Failed to get domain:", err)
+	return true
+}
+
+// handleKeypress runs the action bound to the key on the marked domains, or
+// the selected one if none are marked. Keys bound to an action are consumed.
+func handleKeypress(jobs *jobQueue, pages *tview.Pages, model *domainModel, table *tview.Table, event *tcell.EventKey, actions map[string]Action, bindings map[keyBinding]string) *tcell.EventKey {
+	id, ok := bindings[bindingOf(event)]
+	if !ok {
 		return event
 	}
+	runAction(jobs, pages, model, table, id, actions[id])
+	return nil
+}
+
+// invalidState explains why the action can't run on the domain.
+func invalidState(action Action, vmName string, state libvirt.DomainState) string {
+	return fmt.Sprintf("%s is not possible while %s is %s", action.Label(), vmName, strings.ToLower(humanState(state)))
+}
+
+// runAction runs the action on the marked domains, or the selected one if none
+// are marked, asking for confirmation first if the action is dangerous.
+// Domains in a state the action doesn't apply to are left out.
+func runAction(jobs *jobQueue, pages *tview.Pages, model *domainModel, table *tview.Table, id string, action Action) {
+	if marked := model.marked(); len(marked) > 0 {
+		if _, ok := action.(UIAction); ok {
+			for _, target := range marked {
+				target.dom.Free()
+			}
+			setStatus(action.StartMessage() + " works on a single VM, unmark the VMs first")
+			return
+		}
+		var targets []domainEntry
+		var skipped []bulkResult
+		for _, target := range marked {
+			if action.ValidIn(target.state) {
+				targets = append(targets, target)
+				continue
+			}
+			target.dom.Free()
+			skipped = append(skipped, bulkResult{name: target.name, err: errors.New(invalidState(action, target.name, target.state)), skipped: true})
+		}
+		if len(targets) == 0 {
+			setStatus(action.Label() + " is not possible on any of the marked VMs")
+			return
+		}
+		release := func() {
+			for _, target := range targets {
+				target.dom.Free()
+			}
+		}
+		if !confirmation.required(id, action) {
+			runBulkAction(jobs, action, targets, skipped)
+			return
+		}
+		names := make([]string, len(targets))
+		for i, target := range targets {
+			names[i] = target.name
+		}
+		confirmAction(pages, action, names, func() {
+			runBulkAction(jobs, action, targets, skipped)
+		}, release)
+		return
+	}
+
+	entry, ok := model.selected(table)
+	if !ok {
+		return
+	}
+	vmName, dom := entry.name, entry.dom
+	if !action.ValidIn(entry.state) {
+		setStatus(invalidState(action, vmName, entry.state))
+		return
+	}
 
-	if action, ok := actions[event.Key()]; ok {
+	// UI actions only open a form, they run right away
+	if _, ok := action.(UIAction); ok {
 		setStatus(action.StartMessage() + " " + vmName)
 		if err := action.Execute(dom); err != nil {
 			log.Println(action.FailMessage()+" domain:", err)
 			setStatus(action.FailMessage() + " " + vmName + ". " + libvirtError(err))
-		} else {
-			log.Println("Successfully " + action.SuccessMessage() + " " + vmName)
 		}
+		return
 	}
-	return event
 
+	// the domain could go away before the job runs
+	if err := dom.Ref(); err != nil {
+		log.Println("Failed to reference domain:", err)
+		return
+	}
+	run := func() {
+		setStatus(action.StartMessage() + " " + vmName)
+		jobs.submit(action, dom, vmName, func(err error) {
+			if err != nil {
+				setStatus(action.FailMessage() + " " + vmName + ". " + libvirtError(err))
+			} else {
+				setStatus("Successfully " + action.SuccessMessage() + " " + vmName)
+			}
+		})
+	}
+	if confirmation.required(id, action) {
+		confirmAction(pages, action, []string{vmName}, run, func() {
+			dom.Free()
+		})
+		return
+	}
+	run()
 }
@@ -4,6 +4,7 @@ import (
 	"flag"
 	"log"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/gdamore/tcell/v2"
@@ -47,23 +48,24 @@ func attachDiskXML(dom *libvirt.Domain, diskXML string) error {
 	return nil
 }
 
+var columnTitles = []string{"Name", "State", "CPU Usage", "Memory Usage", "I/O", "Network Usage", "IP"}
+
+var tableColumns = len(columnTitles)
+
 func createTable() *tview.Table {
 	table := tview.NewTable().
 		SetBorders(false).
 		SetSeparator(tview.Borders.Vertical).
 		SetSelectable(true, false).
 		SetFixed(1, 1)
-	setCellSpaces(table, 0, 0, "Name")
-	setCellSpaces(table, 0, 1, "State")
-	setCellSpaces(table, 0, 2, "CPU Usage")
-	setCellSpaces(table, 0, 3, "Memory Usage")
-	setCellSpaces(table, 0, 4, "I/O")
-	setCellSpaces(table, 0, 5, "Network Usage")
+	for i, title := range columnTitles {
+		setCellSpaces(table, 0, i, title)
+	}
 	table.Select(1, 0)
 	table.SetBackgroundColor(tcell.ColorDefault)
 
 	// header diffrent background color
-	for i := 0; i < 6; i++ {
+	for i := 0; i < tableColumns; i++ {
 		table.GetCell(0, i).SetBackgroundColor(tcell.ColorDarkMagenta)
 		table.GetCell(0, i).SetSelectable(false)
 	}
@@ -71,75 +73,102 @@ func createTable() *tview.Table {
 	return table
 }
 
-func runTableRefresher(app *tview.Application, table *tview.Table, conn *libvirt.Connect) {
+func runTableRefresher(app *tview.Application, table *tview.Table, conn *libvirt.Connect, model *domainModel, rc *refreshControl) {
 
-	statProviders := make(map[string]StatProvider)
-	ticker := time.NewTicker(1 * time.Second)
+	interval, paused := rc.settings()
+	ticker := time.NewTicker(interval)
+	rebaseline := false
+	addrSource := rc.addressSource()
+	addresses := newAddressFetcher(app, table, model)
+	ticks := 0
 
 	for {
-		domainList, err := conn.ListAllDomains(0)
+		select {
+		case <-rc.changed:
+			var nowPaused bool
+			interval, nowPaused = rc.settings()
+			// rates across a pause would average over the whole pause
+			if paused && !nowPaused {
+				rebaseline = true
+			}
+			paused = nowPaused
+			if source := rc.addressSource(); source != addrSource {
+				addrSource = source
+				ticks = 0
+			}
+			ticker.Reset(interval)
+			continue
+		case <-ticker.C:
+		}
+		if paused {
+			continue
+		}
+
+		records, err := conn.GetAllDomainStats(nil, statsTypes, libvirt.CONNECT_GET_ALL_DOMAINS_STATS_ACTIVE)
 		if err != nil {
-			log.Println("Failed to get domain list:", err)
+			log.Println("Failed to get domain stats:", err)
 			continue
 		}
+		sampledAt := time.Now()
+		updates := make([]statsUpdate, 0, len(records))
+		refreshAddresses := ticks%addressRefreshTicks == 0
+		ticks++
+		for _, record := range records {
+			uuid, err := record.Domain.GetUUIDString()
+			if err != nil {
+				log.Println("Failed to get domain UUID:", err)
+				record.Domain.Free()
+				continue
+			}
+			if record.State != nil && record.State.State == libvirt.DOMAIN_SHUTOFF {
+				record.Domain.Free()
+				continue
+			}
+			// domains we haven't got a lifecycle event for yet are skipped
+			domStatProvider, ok := model.statProvider(uuid)
+			if !ok {
+				record.Domain.Free()
+				continue
+			}
+			if refreshAddresses {
+				addresses.fetch(record.Domain, uuid, addrSource)
+			} else {
+				record.Domain.Free()
+			}
+			if rebaseline {
+				domStatProvider.reset()
+			}
 
-		select {
-		case <-ticker.C:
-			for i, domain := range domainList {
-				name, err := domain.GetName()
-				if err != nil {
-					log.Println("Failed to get domain name:", err)
-				}
-				setCellSpaces(table, i+1, 0, name)
-				st, _, err := domain.GetState()
-				if err != nil {
-					log.Println("Failed to get domain state:", err)
-				}
-				setCellSpaces(table, i+1, 1, humanState(st))
-
-				if st == libvirt.DOMAIN_SHUTOFF {
-					for j := 2; j < 6; j++ {
-						table.SetCellSimple(i+1, j, "")
-					}
-					continue
-				}
-
-				domStatProvider, ok := statProviders[name]
-				if !ok {
-					domStatProvider = *NewStatProvider(&domain)
-					statProviders[name] = domStatProvider
-				}
-
-				CPU, err := domStatProvider.getCPUUsage(1)
-				if err != nil {
-					log.Println("Failed to get CPU usage:", err)
-
-				}
-				setCellSpaces(table, i+1, 2, CPU)
-				//println(CPU)
-				netStats, err := domStatProvider.getNetworkStats(1)
-				if err != nil {
-					log.Println("Failed to get network stats:", err)
-				}
-				setCellSpaces(table, i+1, 5, netStats)
-
-				diskStats, err := domStatProvider.getDiskStats(1)
-				if err != nil {
-					log.Println("Failed to get disk stats:", err)
-				}
-				setCellSpaces(table, i+1, 4, diskStats)
-
-				memStats, err := domStatProvider.getMemoryStats()
-				if err != nil {
-					log.Println("Failed to get memory stats:", err)
-				}
-				setCellSpaces(table, i+1, 3, memStats)
+			CPU, err := domStatProvider.getCPUUsage(&record, sampledAt)
+			if err != nil {
+				log.Println("Failed to get CPU usage:", err)
 
 			}
-			updateStatusHeight()
-			app.Draw()
+			memStats, err := domStatProvider.getMemoryStats(&record, sampledAt)
+			if err != nil {
+				log.Println("Failed to get memory stats:", err)
+			}
+			diskStats, err := domStatProvider.getDiskStats(&record, sampledAt)
+			if err != nil {
+				log.Println("Failed to get disk stats:", err)
+			}
+			netStats, err := domStatProvider.getNetworkStats(&record, sampledAt)
+			if err != nil {
+				log.Println("Failed to get network stats:", err)
+			}
+			domStatProvider.updateBreakdown(&record, sampledAt)
 
+			updates = append(updates, statsUpdate{
+				uuid:  uuid,
+				cells: [4]string{CPU, memStats, diskStats, netStats},
+				rates: domStatProvider.latestRates(),
+			})
 		}
+		rebaseline = false
+		app.QueueUpdateDraw(func() {
+			model.applyStats(table, updates)
+			updateStatusHeight()
+		})
 	}
 
 }
@@ -150,24 +179,6 @@ func transparentTextView(text string) *tview.TextView {
 	return view
 }
 
-// TODO: improve keybinds, this would be nightmare on non qwerty layouts
-func keybindsGrid() *tview.Grid {
-	grid := tview.NewGrid().
-		SetRows(1, 1).
-		SetColumns(0, 0, 0, 0).
-		SetBorders(false).
-		AddItem(transparentTextView("^Q: Start"), 0, 0, 1, 1, 0, 0, false).
-		AddItem(transparentTextView("^A: Stop"), 1, 0, 1, 1, 0, 0, false).
-		AddItem(transparentTextView("^W: Resume"), 0, 1, 1, 1, 0, 0, false).
-		AddItem(transparentTextView("^S: Suspend"), 1, 1, 1, 1, 0, 0, false).
-		AddItem(transparentTextView("^E: Reboot"), 0, 2, 1, 1, 0, 0, false).
-		AddItem(transparentTextView("^D: Destroy"), 1, 2, 1, 1, 0, 0, false).
-		AddItem(transparentTextView("^R: Attach disk"), 0, 3, 1, 1, 0, 0, false).
-		AddItem(transparentTextView("^F: Detach disk"), 1, 3, 1, 1, 0, 0, false)
-
-	return grid
-}
-
 var grid *tview.Grid
 
 func main() {
@@ -175,33 +186,138 @@ func main() {
 	defer f.Close()
 	log.SetOutput(f)
 	var connectionURI string
+	var interval time.Duration
+	var addrSourceName string
+	var noConfirm string
+	var configPath string
+	var workers int
 	flag.StringVar(&connectionURI, "c", "qemu:///system", "libvirt connection URI")
+	flag.DurationVar(&interval, "interval", time.Second, "statistics refresh interval")
+	flag.StringVar(&addrSourceName, "addr-source", "lease", "source of IP addresses: lease, agent or arp")
+	flag.BoolVar(&confirmation.typeName, "confirm-name", false, "require typing the VM name to confirm dangerous actions")
+	flag.StringVar(&noConfirm, "no-confirm", "", "comma separated IDs of dangerous actions that run without confirmation, e.g. reboot")
+	flag.StringVar(&configPath, "config", defaultConfigPath(), "config file")
+	flag.DurationVar(&shutdown.timeout, "shutdown-timeout", time.Minute, "how long ^T waits for a guest to shut down")
+	flag.BoolVar(&shutdown.force, "shutdown-force", false, "destroy guests that don't shut down in time without asking")
+	flag.IntVar(&workers, "workers", 4, "number of actions run in parallel")
 	flag.Parse()
+	config, err := loadConfig(configPath)
+	if err != nil {
+		panic(err)
+	}
+	addrSource, err := parseAddressSource(addrSourceName)
+	if err != nil {
+		panic(err)
+	}
 	statusView.SetBackgroundColor(tcell.ColorLightGray)
 	statusView.SetTextColor(tcell.ColorBlack)
 	var app *tview.Application = tview.NewApplication()
 	pages := tview.NewPages()
-	var actions = initActions(app, pages)
+	jobs := newJobQueue(app, workers)
+	var actions = initActions(app, pages, jobs)
+	bindings, err := config.keyBindings(actions)
+	if err != nil {
+		panic(err)
+	}
+
+	// flags given on the command line win over the config
+	setFlags := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		setFlags[f.Name] = true
+	})
+	if !setFlags["confirm-name"] {
+		confirmation.typeName = config.Confirm.TypeName
+	}
+	noConfirmIDs := config.Confirm.Disabled
+	if setFlags["no-confirm"] {
+		noConfirmIDs = nil
+		for _, id := range strings.Split(noConfirm, ",") {
+			if id = strings.TrimSpace(id); id != "" {
+				noConfirmIDs = append(noConfirmIDs, id)
+			}
+		}
+	}
+	if err := checkActionIDs(noConfirmIDs, actions); err != nil {
+		panic(err)
+	}
+	for _, id := range noConfirmIDs {
+		confirmation.disabled[id] = true
+	}
 	table := createTable()
+	bar := newKeybindsBar(actions, bindings)
 
 	grid = tview.NewGrid().
 		SetRows(0, 1, 2).
 		SetColumns(0).
 		SetBorders(false).
 		AddItem(statusView, 1, 0, 1, 1, 0, 0, false).
-		AddItem(keybindsGrid(), 2, 0, 1, 1, 0, 0, false).
+		AddItem(bar.grid, 2, 0, 1, 1, 0, 0, false).
 		AddItem(table, 0, 0, 1, 1, 0, 0, true)
 
+	if err := startEventLoop(); err != nil {
+		panic(err)
+	}
 	conn, err := libvirt.NewConnect(connectionURI)
 	if err != nil {
 		panic(err)
 	}
 	defer conn.Close()
+
+	model := newDomainModel()
+	// events are registered before listing so that nothing happening in
+	// between is missed, they are only applied once the app runs
+	callbackID, err := registerLifecycleEvents(conn, app, table, model)
+	if err != nil {
+		panic(err)
+	}
+	defer conn.DomainEventDeregister(callbackID)
+	if err := loadDomains(conn, table, model); err != nil {
+		log.Println("Failed to get domain list:", err)
+	}
+	rc := newRefreshControl(interval, addrSource)
 	table.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
-		return handleKeypress(conn, table, event, actions)
+		// configured bindings come first, so they can take over builtin keys
+		if event = handleKeypress(jobs, pages, model, table, event, actions, bindings); event == nil {
+			return nil
+		}
+		if handleRefreshKeys(rc, event) || handleTableKeys(pages, table, model, event) {
+			return nil
+		}
+		switch event.Rune() {
+		case 'J':
+			showJobs(app, pages, jobs)
+			return nil
+		case 'S':
+			showStorage(app, pages, conn, jobs)
+			return nil
+		case 'N':
+			showNetworks(app, pages, conn, jobs)
+			return nil
+		case ':':
+			showCommandPalette(jobs, pages, model, table, actions)
+			return nil
+		case '?':
+			entry, _ := model.selected(table)
+			showHelp(pages, actions, bindings, entry)
+			return nil
+		}
+		return event
+	})
+
+	table.SetSelectedFunc(func(row, column int) {
+		if entry, ok := model.selected(table); ok {
+			showDetails(app, pages, entry, rc.addressSource())
+		}
+	})
+
+	// the selection and the state of the selected domain change in many
+	// places, so the bar is brought up to date before every draw
+	app.SetBeforeDrawFunc(func(screen tcell.Screen) bool {
+		bar.update(model.selected(table))
+		return false
 	})
 
-	go runTableRefresher(app, table, conn)
+	go runTableRefresher(app, table, conn, model, rc)
 
 	pages.AddAndSwitchToPage("MainTable", grid, true)
 	if err := app.SetRoot(pages, true).SetFocus(table).Run(); err != nil {
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/beevik/etree"
+	"libvirt.org/go/libvirt"
+)
+
+type networkInfo struct {
+	name      string
+	active    bool
+	autostart bool
+	bridge    string
+	// forward is the forward mode, e.g. nat, "isolated" without one
+	forward string
+	// ranges are the networks' addresses with their DHCP ranges
+	ranges []string
+}
+
+type leaseInfo struct {
+	ip       string
+	mac      string
+	hostname string
+	vmName   string
+	expiry   string
+}
+
+// parseNetworkXML fills in the forward mode and IP ranges of the network.
+func parseNetworkXML(xmlDesc string, info *networkInfo) error {
+	doc := etree.NewDocument()
+	if err := doc.ReadFromString(xmlDesc); err != nil {
+		return fmt.Errorf("failed to parse XML: %w", err)
+	}
+	info.forward = "isolated"
+	if forward := doc.FindElement("/network/forward"); forward != nil {
+		info.forward = forward.SelectAttrValue("mode", "nat")
+	}
+	for _, ip := range doc.FindElements("/network/ip") {
+		address := ip.SelectAttrValue("address", "")
+		if prefix := ip.SelectAttrValue("prefix", ""); prefix != "" {
+			address += "/" + prefix
+		} else if netmask := ip.SelectAttrValue("netmask", ""); netmask != "" {
+			address += "/" + netmask
+		}
+		for _, dhcpRange := range ip.FindElements("dhcp/range") {
+			address += fmt.Sprintf(" (DHCP %s-%s)", dhcpRange.SelectAttrValue("start", ""), dhcpRange.SelectAttrValue("end", ""))
+		}
+		info.ranges = append(info.ranges, address)
+	}
+	return nil
+}
+
+// listNetworks returns every virtual network of the connection sorted by name.
+func listNetworks(conn *libvirt.Connect) ([]networkInfo, error) {
+	networks, err := conn.ListAllNetworks(0)
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]networkInfo, 0, len(networks))
+	for _, network := range networks {
+		var info networkInfo
+		if info.name, err = network.GetName(); err != nil {
+			log.Println("Failed to get network name:", err)
+			network.Free()
+			continue
+		}
+		if info.active, err = network.IsActive(); err != nil {
+			log.Println("Failed to get network state:", err)
+		}
+		if info.autostart, err = network.GetAutostart(); err != nil {
+			log.Println("Failed to get network autostart:", err)
+		}
+		if info.active {
+			if info.bridge, err = network.GetBridgeName(); err != nil {
+				log.Println("Failed to get network bridge:", err)
+			}
+		}
+		if xmlDesc, err := network.GetXMLDesc(0); err != nil {
+			log.Println("Failed to get network XML description:", err)
+		} else if err := parseNetworkXML(xmlDesc, &info); err != nil {
+			log.Println("Failed to parse network XML:", err)
+		}
+		network.Free()
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].name < infos[j].name
+	})
+	return infos, nil
+}
+
+// domainsByMAC maps the MAC address of every interface to its domain's name.
+func domainsByMAC(conn *libvirt.Connect) (map[string]string, error) {
+	doms, err := conn.ListAllDomains(0)
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[string]string)
+	for _, dom := range doms {
+		name, err := dom.GetName()
+		if err != nil {
+			log.Println("Failed to get domain name:", err)
+			dom.Free()
+			continue
+		}
+		interfaces, err := createInterfaceList(&dom, 0)
+		if err != nil {
+			log.Println("Failed to get interfaces of", name+":", err)
+		}
+		for _, iface := range interfaces {
+			names[iface.MAC] = name
+		}
+		dom.Free()
+	}
+	return names, nil
+}
+
+// listLeases returns the DHCP leases of the network with the VM holding each,
+// looked up in vmNames by MAC address.
+func listLeases(conn *libvirt.Connect, networkName string, vmNames map[string]string) ([]leaseInfo, error) {
+	var leases []libvirt.NetworkDHCPLease
+	err := withNetwork(conn, networkName, func(network *libvirt.Network) error {
+		var err error
+		leases, err = network.GetDHCPLeases()
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]leaseInfo, 0, len(leases))
+	for _, lease := range leases {
+		infos = append(infos, leaseInfo{
+			ip:       fmt.Sprintf("%s/%d", lease.IPaddr, lease.Prefix),
+			mac:      lease.Mac,
+			hostname: lease.Hostname,
+			vmName:   vmNames[strings.ToLower(lease.Mac)],
+			expiry:   lease.ExpiryTime.Format("2006-01-02 15:04:05"),
+		})
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].ip < infos[j].ip
+	})
+	return infos, nil
+}
+
+// withNetwork looks up the network by name for fn.
+func withNetwork(conn *libvirt.Connect, name string, fn func(network *libvirt.Network) error) error {
+	network, err := conn.LookupNetworkByName(name)
+	if err != nil {
+		return err
+	}
+	defer network.Free()
+	return fn(network)
+}
+
+// networkXML describes a network with the forward mode, e.g. nat, and DHCP
+// over the given range. An empty or "isolated" forward mode makes it
+// isolated, empty DHCP addresses leave DHCP off.
+func networkXML(name, forward, address, netmask, dhcpStart, dhcpEnd string) (string, error) {
+	if name == "" || address == "" || netmask == "" {
+		return "", errors.New("the network needs a name, an address and a netmask")
+	}
+	if (dhcpStart == "") != (dhcpEnd == "") {
+		return "", errors.New("the DHCP range needs a start and an end")
+	}
+	doc := etree.NewDocument()
+	network := doc.CreateElement("network")
+	network.CreateElement("name").SetText(name)
+	if forward != "" && forward != "isolated" {
+		network.CreateElement("forward").CreateAttr("mode", forward)
+	}
+	ip := network.CreateElement("ip")
+	ip.CreateAttr("address", address)
+	ip.CreateAttr("netmask", netmask)
+	if dhcpStart != "" && dhcpEnd != "" {
+		dhcpRange := ip.CreateElement("dhcp").CreateElement("range")
+		dhcpRange.CreateAttr("start", dhcpStart)
+		dhcpRange.CreateAttr("end", dhcpEnd)
+	}
+	return doc.WriteToString()
+}
+
+func defineNetwork(conn *libvirt.Connect, xmlDesc string) error {
+	network, err := conn.NetworkDefineXML(xmlDesc)
+	if err != nil {
+		return err
+	}
+	return network.Free()
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+	"libvirt.org/go/libvirt"
+)
+
+const networkKeys = "s: Start  x: Stop  A: Autostart  n: Define  u: Undefine  Tab: Leases  q: Back"
+
+// networkView is the networks page, the virtual networks on top and the DHCP
+// leases of the selected network below.
+type networkView struct {
+	hostView
+	networks     []networkInfo
+	networkTable *tview.Table
+	leaseTable   *tview.Table
+	// leaseLoads counts the started lease loads, a load is only shown if no
+	// other one started after it
+	leaseLoads atomic.Int64
+	// vmNames maps MAC addresses to VM names, see vmNamesByMAC
+	vmNames     map[string]string
+	vmNamesOnce sync.Once
+}
+
+func (v *networkView) selectedNetwork() (networkInfo, bool) {
+	row, _ := v.networkTable.GetSelection()
+	if row < 1 || row > len(v.networks) {
+		return networkInfo{}, false
+	}
+	return v.networks[row-1], true
+}
+
+// reload lists the networks again and keeps the selection by name.
+// Selecting the network loads its leases.
+func (v *networkView) reload() {
+	v.background(func() func() {
+		networks, err := listNetworks(v.conn)
+		return func() {
+			if err != nil {
+				log.Println("Failed to list networks:", err)
+				setStatus("Failed to list networks: " + libvirtError(err))
+			}
+			selected, _ := v.selectedNetwork()
+			v.networks = networks
+
+			setListHeader(v.networkTable, []string{"Name", "Active", "Autostart", "Bridge", "Forward", "IP ranges"})
+			row := 1
+			yesNo := map[bool]string{true: "yes", false: "no"}
+			for i, network := range networks {
+				setCellSpaces(v.networkTable, i+1, 0, network.name)
+				setCellSpaces(v.networkTable, i+1, 1, yesNo[network.active])
+				setCellSpaces(v.networkTable, i+1, 2, yesNo[network.autostart])
+				setCellSpaces(v.networkTable, i+1, 3, network.bridge)
+				setCellSpaces(v.networkTable, i+1, 4, network.forward)
+				setCellSpaces(v.networkTable, i+1, 5, strings.Join(network.ranges, ", "))
+				if network.name == selected.name {
+					row = i + 1
+				}
+			}
+			v.networkTable.Select(row, 0)
+		}
+	})
+}
+
+// vmNamesByMAC returns which VM every MAC address belongs to. The map is
+// built once, when the leases are first loaded, as that needs the XML of
+// every domain.
+func (v *networkView) vmNamesByMAC() map[string]string {
+	v.vmNamesOnce.Do(func() {
+		var err error
+		if v.vmNames, err = domainsByMAC(v.conn); err != nil {
+			log.Println("Failed to list domains:", err)
+		}
+	})
+	return v.vmNames
+}
+
+// loadLeases lists the DHCP leases of the selected network. Only the last of
+// several loads started in a row is shown.
+func (v *networkView) loadLeases() {
+	setListHeader(v.leaseTable, []string{"IP", "MAC", "Hostname", "VM", "Expires"})
+	gen := v.leaseLoads.Add(1)
+	network, ok := v.selectedNetwork()
+	if !ok {
+		return
+	}
+	v.leaseTable.SetTitle("DHCP leases of " + network.name)
+	if !network.active {
+		return
+	}
+	v.background(func() func() {
+		time.Sleep(selectionLoadDelay)
+		if v.leaseLoads.Load() != gen {
+			return func() {}
+		}
+		leases, err := listLeases(v.conn, network.name, v.vmNamesByMAC())
+		return func() {
+			if v.leaseLoads.Load() != gen {
+				return
+			}
+			if err != nil {
+				log.Println("Failed to get DHCP leases:", err)
+				setStatus("Failed to get DHCP leases of " + network.name + ": " + libvirtError(err))
+				return
+			}
+			for i, lease := range leases {
+				setCellSpaces(v.leaseTable, i+1, 0, lease.ip)
+				setCellSpaces(v.leaseTable, i+1, 1, lease.mac)
+				setCellSpaces(v.leaseTable, i+1, 2, lease.hostname)
+				setCellSpaces(v.leaseTable, i+1, 3, lease.vmName)
+				setCellSpaces(v.leaseTable, i+1, 4, lease.expiry)
+			}
+		}
+	})
+}
+
+func (v *networkView) handleNetworkKeys(event *tcell.EventKey) *tcell.EventKey {
+	if event.Rune() == 'n' {
+		labels := []string{"Name: ", "Forward mode (nat, route, isolated): ", "Address: ", "Netmask: ", "DHCP start: ", "DHCP end: "}
+		defaults := []string{"", "nat", "192.168.150.1", "255.255.255.0", "192.168.150.2", "192.168.150.254"}
+		v.showForm("Define network", labels, defaults, func(values []string) (SimpleAction, string, error) {
+			name := values[0]
+			xmlDesc, err := networkXML(name, values[1], values[2], values[3], values[4], values[5])
+			if err != nil {
+				return SimpleAction{}, "", err
+			}
+			return hostAction("Define network", "Defining network", "defined network", "Failed to define network", false, func() error {
+				return defineNetwork(v.conn, xmlDesc)
+			}), name, nil
+		})
+		return nil
+	}
+
+	network, ok := v.selectedNetwork()
+	if !ok {
+		return event
+	}
+	name := network.name
+	var action SimpleAction
+	switch event.Rune() {
+	case 's':
+		action = hostAction("Start network", "Starting network", "started network", "Failed to start network", false, func() error {
+			return withNetwork(v.conn, name, (*libvirt.Network).Create)
+		})
+	case 'x':
+		action = hostAction("Stop network", "Stopping network", "stopped network", "Failed to stop network", true, func() error {
+			return withNetwork(v.conn, name, (*libvirt.Network).Destroy)
+		})
+	case 'A':
+		autostart := !network.autostart
+		action = hostAction("Autostart network", "Toggling autostart of network", "toggled autostart of network", "Failed to toggle autostart of network", false, func() error {
+			return withNetwork(v.conn, name, func(n *libvirt.Network) error {
+				return n.SetAutostart(autostart)
+			})
+		})
+	case 'u':
+		action = hostAction("Undefine network", "Undefining network", "undefined network", "Failed to undefine network", true, func() error {
+			return withNetwork(v.conn, name, (*libvirt.Network).Undefine)
+		})
+	default:
+		return event
+	}
+	v.submit(action, name)
+	return nil
+}
+
+func createNetworksGrid(app *tview.Application, pages *tview.Pages, conn *libvirt.Connect, jobs *jobQueue) *tview.Grid {
+	v := &networkView{
+		hostView:     hostView{app: app, pages: pages, conn: conn, jobs: jobs, page: "Networks"},
+		networkTable: newListTable("Networks"),
+		leaseTable:   newListTable("DHCP leases"),
+	}
+	v.hostView.reload = v.reload
+	v.networkTable.SetSelectionChangedFunc(func(row, column int) {
+		v.loadLeases()
+	})
+	v.reload()
+	v.networkTable.SetInputCapture(v.handleNetworkKeys)
+
+	networksGrid := tview.NewGrid().
+		SetRows(0, 0, 1, 1).
+		SetColumns(0).
+		SetBorders(false).
+		AddItem(v.networkTable, 0, 0, 1, 1, 0, 0, true).
+		AddItem(v.leaseTable, 1, 0, 1, 1, 0, 0, false).
+		AddItem(statusView, 2, 0, 1, 1, 0, 0, false).
+		AddItem(transparentTextView(networkKeys), 3, 0, 1, 1, 0, 0, false)
+	networksGrid.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		switch {
+		case event.Key() == tcell.KeyEscape || event.Rune() == 'q':
+			pages.SwitchToPage("MainTable")
+			pages.RemovePage("Networks")
+			return nil
+		case event.Key() == tcell.KeyTab:
+			if v.networkTable.HasFocus() {
+				app.SetFocus(v.leaseTable)
+			} else {
+				app.SetFocus(v.networkTable)
+			}
+			return nil
+		}
+		return event
+	})
+	return networksGrid
+}
+
+func showNetworks(app *tview.Application, pages *tview.Pages, conn *libvirt.Connect, jobs *jobQueue) {
+	pages.AddPage("Networks", createNetworksGrid(app, pages, conn, jobs), true, false)
+	pages.SwitchToPage("Networks")
+}
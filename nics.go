@@ -0,0 +1,276 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/beevik/etree"
+	"github.com/rivo/tview"
+	"libvirt.org/go/libvirt"
+)
+
+var nicModels = []string{"virtio", "e1000", "e1000e", "rtl8139"}
+
+// interfaceXML describes a NIC connected to a virtual network or a host
+// bridge. An empty MAC lets libvirt generate one.
+func interfaceXML(sourceType, source, model, mac string) (string, error) {
+	if sourceType != "network" && sourceType != "bridge" {
+		return "", fmt.Errorf("unknown interface type %q, use network or bridge", sourceType)
+	}
+	doc := etree.NewDocument()
+	iface := doc.CreateElement("interface")
+	iface.CreateAttr("type", sourceType)
+	if mac != "" {
+		iface.CreateElement("mac").CreateAttr("address", mac)
+	}
+	iface.CreateElement("source").CreateAttr(sourceType, source)
+	if model != "" {
+		iface.CreateElement("model").CreateAttr("type", model)
+	}
+	return doc.WriteToString()
+}
+
+func attachInterface(dom *libvirt.Domain, sourceType, source, model, mac string, flags libvirt.DomainDeviceModifyFlags) error {
+	xmlDesc, err := interfaceXML(sourceType, source, model, mac)
+	if err != nil {
+		return err
+	}
+	if err := dom.AttachDeviceFlags(xmlDesc, flags); err != nil {
+		log.Println("Failed to attach interface:", err)
+		return err
+	}
+	log.Println("Interface attached successfully")
+	return nil
+}
+
+// domainInterfaceXML returns the <interface> element with the MAC address
+// from the domain's XML read with xmlFlags.
+func domainInterfaceXML(dom *libvirt.Domain, mac string, xmlFlags libvirt.DomainXMLFlags) (string, error) {
+	xmlDesc, err := dom.GetXMLDesc(xmlFlags)
+	if err != nil {
+		return "", fmt.Errorf("failed to get XML description: %w", err)
+	}
+	doc := etree.NewDocument()
+	if err := doc.ReadFromString(xmlDesc); err != nil {
+		return "", fmt.Errorf("failed to parse XML: %w", err)
+	}
+	for _, iface := range doc.FindElements("//devices/interface") {
+		macElement := iface.SelectElement("mac")
+		if macElement == nil || !strings.EqualFold(macElement.SelectAttrValue("address", ""), mac) {
+			continue
+		}
+		ifaceDoc := etree.NewDocument()
+		ifaceDoc.SetRoot(iface.Copy())
+		return ifaceDoc.WriteToString()
+	}
+	return "", fmt.Errorf("no interface with MAC %s", mac)
+}
+
+// detachInterface unplugs the NIC with the MAC address, using its exact XML
+// from the domain, from the config for a change to the config only.
+func detachInterface(dom *libvirt.Domain, mac string, flags libvirt.DomainDeviceModifyFlags) error {
+	xmlDesc, err := domainInterfaceXML(dom, mac, deviceXMLFlags(flags))
+	if err != nil {
+		return err
+	}
+	if err := dom.DetachDeviceFlags(xmlDesc, flags); err != nil {
+		log.Println("Failed to detach interface:", err)
+		return err
+	}
+	log.Println("Interface detached successfully")
+	return nil
+}
+
+// closeNICForm removes the form and drops its reference to dom.
+func closeNICForm(pages *tview.Pages, dom *libvirt.Domain) {
+	pages.SwitchToPage("MainTable")
+	pages.RemovePage("NICForm")
+	dom.Free()
+}
+
+// showNICForm shows the form, which keeps a reference to dom until it is
+// closed, the domain could be undefined while it is open.
+func showNICForm(pages *tview.Pages, form *tview.Form, dom *libvirt.Domain) error {
+	if err := dom.Ref(); err != nil {
+		return err
+	}
+	form.SetCancelFunc(func() {
+		closeNICForm(pages, dom)
+	})
+	nicGrid := tview.NewGrid().
+		SetRows(0, 1).
+		SetColumns(0).
+		SetBorders(false).
+		AddItem(statusView, 1, 0, 1, 1, 0, 0, false).
+		AddItem(form, 0, 0, 1, 1, 0, 0, true)
+	pages.AddPage("NICForm", nicGrid, true, false)
+	pages.SwitchToPage("NICForm")
+	return nil
+}
+
+// networkNames returns the names of the virtual networks on the domain's host.
+func networkNames(dom *libvirt.Domain) []string {
+	conn, err := dom.DomainGetConnect()
+	if err != nil {
+		log.Println("Failed to get connection:", err)
+		return nil
+	}
+	defer conn.Close()
+	networks, err := listNetworks(conn)
+	if err != nil {
+		log.Println("Failed to list networks:", err)
+	}
+	names := make([]string, 0, len(networks))
+	for _, network := range networks {
+		names = append(names, network.name)
+	}
+	return names
+}
+
+func attachNIC(dom *libvirt.Domain, pages *tview.Pages, jobs *jobQueue) error {
+	vmName, err := dom.GetName()
+	if err != nil {
+		vmName = ""
+	}
+	networks := networkNames(dom)
+	form := tview.NewForm()
+	sourceInput := tview.NewInputField().
+		SetLabel("Source: ").
+		SetText("default").
+		SetFieldWidth(30).
+		SetAutocompleteFunc(func(currentText string) (entries []string) {
+			_, sourceType := form.GetFormItemByLabel("Type: ").(*tview.DropDown).GetCurrentOption()
+			if sourceType != "network" {
+				return nil
+			}
+			for _, name := range networks {
+				if strings.HasPrefix(name, currentText) {
+					entries = append(entries, name)
+				}
+			}
+			return
+		})
+	form.
+		AddDropDown("Type: ", []string{"network", "bridge"}, 0, nil).
+		AddFormItem(sourceInput).
+		AddDropDown("Model: ", nicModels, 0, nil).
+		AddInputField("MAC (empty to generate): ", "", 20, nil, nil).
+		AddDropDown("Apply to: ", deviceModifyModes, defaultModifyMode(dom), nil).
+		AddButton("Submit", func() {
+			_, sourceType := form.GetFormItemByLabel("Type: ").(*tview.DropDown).GetCurrentOption()
+			source := sourceInput.GetText()
+			_, model := form.GetFormItemByLabel("Model: ").(*tview.DropDown).GetCurrentOption()
+			mac := form.GetFormItemByLabel("MAC (empty to generate): ").(*tview.InputField).GetText()
+			mode, _ := form.GetFormItemByLabel("Apply to: ").(*tview.DropDown).GetCurrentOption()
+			// check the input before the form is gone
+			if _, err := interfaceXML(sourceType, source, model, mac); err != nil {
+				setStatus("Failed to attach interface: " + err.Error())
+				return
+			}
+			action := NewSimpleAction(Meta{label: "Attach NIC"}, "Attaching interface to", "attached interface to", "Failed to attach interface to", func(d *libvirt.Domain) error {
+				return attachInterface(d, sourceType, source, model, mac, deviceModifyFlags(mode))
+			})
+			submitDomainJob(jobs, action, dom, vmName, nil)
+			closeNICForm(pages, dom)
+		}).
+		AddButton("Cancel", func() {
+			closeNICForm(pages, dom)
+		})
+	form.SetBorder(true).SetTitle("Attach interface to " + vmName).SetTitleAlign(tview.AlignLeft)
+	return showNICForm(pages, form, dom)
+}
+
+// interfaceOptions describes the interfaces for the detach form.
+func interfaceOptions(interfaces []Interface) []string {
+	options := make([]string, 0, len(interfaces))
+	for _, iface := range interfaces {
+		options = append(options, fmt.Sprintf("%s (%s %s, %s)", iface.MAC, iface.Type, iface.Source, iface.Model))
+	}
+	return options
+}
+
+// detachNIC asks which interface to unplug. The interfaces are those of the
+// live domain or, when only the config is changed, of the config.
+func detachNIC(dom *libvirt.Domain, pages *tview.Pages, jobs *jobQueue) error {
+	vmName, err := dom.GetName()
+	if err != nil {
+		vmName = ""
+	}
+	// the interfaces are listed by the Apply to callback, which also runs
+	// when the dropdown is added
+	var interfaces []Interface
+	form := tview.NewForm()
+	interfaceDropDown := tview.NewDropDown().
+		SetLabel("Interface: ")
+	form.
+		AddFormItem(interfaceDropDown).
+		AddDropDown("Apply to: ", deviceModifyModes, defaultModifyMode(dom), func(option string, mode int) {
+			list, err := createInterfaceList(dom, deviceXMLFlags(deviceModifyFlags(mode)))
+			if err != nil {
+				log.Println("Failed to get interfaces:", err)
+				setStatus("Failed to get interfaces: " + libvirtError(err))
+			}
+			interfaces = list
+			interfaceDropDown.SetOptions(interfaceOptions(interfaces), nil)
+			interfaceDropDown.SetCurrentOption(0)
+		}).
+		AddButton("Submit", func() {
+			index, _ := interfaceDropDown.GetCurrentOption()
+			mode, _ := form.GetFormItemByLabel("Apply to: ").(*tview.DropDown).GetCurrentOption()
+			if index < 0 || index >= len(interfaces) {
+				setStatus("No interface to detach")
+				return
+			}
+			mac := interfaces[index].MAC
+			action := NewSimpleAction(Meta{label: "Detach NIC"}, "Detaching interface "+mac+" from", "detached interface "+mac+" from", "Failed to detach interface "+mac+" from", func(d *libvirt.Domain) error {
+				return detachInterface(d, mac, deviceModifyFlags(mode))
+			})
+			submitDomainJob(jobs, action, dom, vmName, nil)
+			closeNICForm(pages, dom)
+		}).
+		AddButton("Cancel", func() {
+			closeNICForm(pages, dom)
+		})
+	form.SetBorder(true).SetTitle("Detach interface from " + vmName).SetTitleAlign(tview.AlignLeft)
+	return showNICForm(pages, form, dom)
+}
+
+// attachNICArgs attaches a NIC given as "<network|bridge> <source> [model]
+// [mac]". --live or --config choose where, by default it is both for a
+// running persistent domain.
+func attachNICArgs(dom *libvirt.Domain, args []string) error {
+	flags, args, ok := modifyFlagsArg(args)
+	if !ok {
+		flags = deviceModifyFlags(defaultModifyMode(dom))
+	}
+	if len(args) < 2 || len(args) > 4 {
+		return errors.New("usage: attach-nic <network|bridge> <source> [model] [mac] [--live] [--config]")
+	}
+	model, mac := nicModels[0], ""
+	if len(args) > 2 {
+		model = args[2]
+	}
+	if len(args) > 3 {
+		mac = args[3]
+	}
+	return attachInterface(dom, args[0], args[1], model, mac, flags)
+}
+
+// detachNICArgs detaches the NIC given by its MAC address. --live or
+// --config choose where, by default it is wherever the NIC is.
+func detachNICArgs(dom *libvirt.Domain, args []string) error {
+	flags, args, ok := modifyFlagsArg(args)
+	if len(args) != 1 {
+		return errors.New("usage: detach-nic <mac> [--live] [--config]")
+	}
+	mac := args[0]
+	if !ok {
+		flags = detachModifyFlags(dom, func(xmlFlags libvirt.DomainXMLFlags) bool {
+			_, err := domainInterfaceXML(dom, mac, xmlFlags)
+			return err == nil
+		})
+	}
+	return detachInterface(dom, mac, flags)
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// fuzzyScore matches the pattern as a case insensitive subsequence of text.
+// Consecutive characters and characters at the start of a word score higher,
+// ok is false if the pattern doesn't match at all.
+func fuzzyScore(pattern, text string) (score int, ok bool) {
+	p := []rune(strings.ToLower(pattern))
+	t := []rune(strings.ToLower(text))
+	if len(p) == 0 {
+		return 0, true
+	}
+	i := 0
+	prev := -2
+	for pos, r := range t {
+		if i == len(p) {
+			break
+		}
+		if r != p[i] {
+			continue
+		}
+		score++
+		if pos == prev+1 {
+			score += 2
+		}
+		if pos == 0 || !unicode.IsLetter(t[pos-1]) {
+			score += 3
+		}
+		prev = pos
+		i++
+	}
+	if i < len(p) {
+		return 0, false
+	}
+	// prefer the shorter of otherwise equal matches
+	return score*100 - len(t), true
+}
+
+// matchActions returns the IDs of the actions whose ID or label matches the
+// pattern, best match first.
+func matchActions(pattern string, actions map[string]Action) []string {
+	scores := make(map[string]int)
+	var ids []string
+	for _, id := range actionOrder {
+		idScore, idOK := fuzzyScore(pattern, id)
+		labelScore, labelOK := fuzzyScore(pattern, actions[id].Label())
+		if !idOK && !labelOK {
+			continue
+		}
+		if !idOK || labelOK && labelScore > idScore {
+			idScore = labelScore
+		}
+		scores[id] = idScore
+		ids = append(ids, id)
+	}
+	sort.SliceStable(ids, func(i, j int) bool {
+		return scores[ids[i]] > scores[ids[j]]
+	})
+	return ids
+}
+
+// resolveAction returns the ID of the action named by the word: the action
+// with that ID or label, or the only action matching it. Several matches are
+// an error listing them, rather than guessing.
+func resolveAction(word string, actions map[string]Action) (string, error) {
+	for _, id := range actionOrder {
+		if strings.EqualFold(word, id) || strings.EqualFold(word, actions[id].Label()) {
+			return id, nil
+		}
+	}
+	ids := matchActions(word, actions)
+	switch len(ids) {
+	case 0:
+		return "", errors.New("no action matches " + word)
+	case 1:
+		return ids[0], nil
+	default:
+		return "", errors.New(word + " matches " + strings.Join(ids, ", ") + ", pick one")
+	}
+}
+
+// splitArgs splits the command line at spaces. Single or double quotes keep
+// spaces in a word and a backslash escapes the next character, e.g.
+// attach-disk "/srv/my images/x.qcow2".
+func splitArgs(line string) ([]string, error) {
+	var words []string
+	var word strings.Builder
+	inWord, escaped := false, false
+	var quote rune
+	for _, r := range line {
+		switch {
+		case escaped:
+			word.WriteRune(r)
+			escaped = false
+		case r == '\\':
+			inWord, escaped = true, true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '"' || r == '\'':
+			inWord, quote = true, r
+		case unicode.IsSpace(r):
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			inWord = true
+			word.WriteRune(r)
+		}
+	}
+	if quote != 0 {
+		return nil, errors.New("unterminated quote")
+	}
+	if escaped {
+		return nil, errors.New("backslash at the end")
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
+
+// showCommandPalette opens an input line at the bottom of the screen that
+// runs any action by name on the marked or selected domains. The name has to
+// match one action, the completion list shows the candidates while typing.
+// Words after the action name are passed as arguments to actions that take
+// them, e.g. "attach-disk /var/lib/libvirt/images/x.qcow2 vdb".
+func showCommandPalette(jobs *jobQueue, pages *tview.Pages, model *domainModel, table *tview.Table, actions map[string]Action) {
+	input := tview.NewInputField().
+		SetLabel(": ")
+	input.SetAutocompleteFunc(func(text string) []string {
+		if strings.ContainsRune(text, ' ') {
+			return nil
+		}
+		return matchActions(text, actions)
+	})
+	input.SetDoneFunc(func(key tcell.Key) {
+		pages.RemovePage("Palette")
+		if key != tcell.KeyEnter {
+			return
+		}
+		words, err := splitArgs(input.GetText())
+		if err != nil {
+			setStatus("Invalid command: " + err.Error())
+			return
+		}
+		if len(words) == 0 {
+			return
+		}
+		id, err := resolveAction(words[0], actions)
+		if err != nil {
+			setStatus("Invalid command: " + err.Error())
+			return
+		}
+		action := actions[id]
+		if args := words[1:]; len(args) > 0 {
+			argsAction, ok := action.(ArgsAction)
+			if !ok {
+				setStatus(id + " takes no arguments")
+				return
+			}
+			withArgs, err := argsAction.WithArgs(args)
+			if err != nil {
+				setStatus(id + " " + err.Error())
+				return
+			}
+			action = withArgs
+		}
+		runAction(jobs, pages, model, table, id, action)
+	})
+
+	prompt := tview.NewFlex().
+		SetDirection(tview.FlexRow).
+		AddItem(nil, 0, 1, false).
+		AddItem(input, 1, 0, true)
+	pages.AddPage("Palette", prompt, true, true)
+}
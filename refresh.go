@@ -0,0 +1,169 @@
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/rivo/tview"
+	"libvirt.org/go/libvirt"
+)
+
+const (
+	minRefreshInterval = 250 * time.Millisecond
+	maxRefreshInterval = time.Minute
+)
+
+// addressRefreshTicks is how many samples are taken between refreshes of
+// the IP column, addresses need a call per domain so they are not fetched
+// on every tick.
+const addressRefreshTicks = 10
+
+// maxAddressFetches is how many domains have their addresses looked up at
+// the same time.
+const maxAddressFetches = 4
+
+// addressFetcher looks up the IP addresses of domains in the background, so
+// a guest agent that doesn't answer doesn't hold up the statistics. A domain
+// whose last lookup hasn't finished yet is skipped.
+type addressFetcher struct {
+	app   *tview.Application
+	table *tview.Table
+	model *domainModel
+	slots chan struct{}
+
+	mu      sync.Mutex
+	pending map[string]bool
+}
+
+func newAddressFetcher(app *tview.Application, table *tview.Table, model *domainModel) *addressFetcher {
+	return &addressFetcher{
+		app:     app,
+		table:   table,
+		model:   model,
+		slots:   make(chan struct{}, maxAddressFetches),
+		pending: make(map[string]bool),
+	}
+}
+
+// fetch looks up the addresses of the domain and stores them in the model.
+// It takes ownership of dom.
+func (f *addressFetcher) fetch(dom *libvirt.Domain, uuid string, source libvirt.DomainInterfaceAddressesSource) {
+	f.mu.Lock()
+	if f.pending[uuid] {
+		f.mu.Unlock()
+		dom.Free()
+		return
+	}
+	f.pending[uuid] = true
+	f.mu.Unlock()
+
+	go func() {
+		f.slots <- struct{}{}
+		addresses, err := domainAddresses(dom, source)
+		<-f.slots
+		dom.Free()
+		f.mu.Lock()
+		delete(f.pending, uuid)
+		f.mu.Unlock()
+		if err != nil {
+			log.Println("Failed to get interface addresses:", err)
+		}
+		f.app.QueueUpdateDraw(func() {
+			f.model.setAddresses(f.table, uuid, addresses)
+		})
+	}()
+}
+
+// refreshControl holds the statistics sampling interval, whether sampling
+// is paused and where IP addresses come from. The refresher is woken up
+// through the changed channel whenever any of them is modified.
+type refreshControl struct {
+	mu         sync.Mutex
+	interval   time.Duration
+	paused     bool
+	addrSource libvirt.DomainInterfaceAddressesSource
+	changed    chan struct{}
+}
+
+func newRefreshControl(interval time.Duration, addrSource libvirt.DomainInterfaceAddressesSource) *refreshControl {
+	return &refreshControl{
+		interval:   clampInterval(interval),
+		addrSource: addrSource,
+		changed:    make(chan struct{}, 1),
+	}
+}
+
+func clampInterval(interval time.Duration) time.Duration {
+	if interval < minRefreshInterval {
+		return minRefreshInterval
+	}
+	if interval > maxRefreshInterval {
+		return maxRefreshInterval
+	}
+	return interval
+}
+
+func (rc *refreshControl) settings() (time.Duration, bool) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return rc.interval, rc.paused
+}
+
+func (rc *refreshControl) notify() {
+	select {
+	case rc.changed <- struct{}{}:
+	default:
+	}
+}
+
+// faster halves the sampling interval.
+func (rc *refreshControl) faster() time.Duration {
+	rc.mu.Lock()
+	rc.interval = clampInterval(rc.interval / 2)
+	interval := rc.interval
+	rc.mu.Unlock()
+	rc.notify()
+	return interval
+}
+
+// slower doubles the sampling interval.
+func (rc *refreshControl) slower() time.Duration {
+	rc.mu.Lock()
+	rc.interval = clampInterval(rc.interval * 2)
+	interval := rc.interval
+	rc.mu.Unlock()
+	rc.notify()
+	return interval
+}
+
+// togglePause freezes or resumes sampling and returns whether it is paused now.
+func (rc *refreshControl) togglePause() bool {
+	rc.mu.Lock()
+	rc.paused = !rc.paused
+	paused := rc.paused
+	rc.mu.Unlock()
+	rc.notify()
+	return paused
+}
+
+func (rc *refreshControl) addressSource() libvirt.DomainInterfaceAddressesSource {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return rc.addrSource
+}
+
+// nextAddressSource switches to the next source of IP addresses.
+func (rc *refreshControl) nextAddressSource() libvirt.DomainInterfaceAddressesSource {
+	rc.mu.Lock()
+	for i, src := range addressSources {
+		if src.source == rc.addrSource {
+			rc.addrSource = addressSources[(i+1)%len(addressSources)].source
+			break
+		}
+	}
+	source := rc.addrSource
+	rc.mu.Unlock()
+	rc.notify()
+	return source
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/rivo/tview"
+	"libvirt.org/go/libvirt"
+)
+
+// shutdownSettings controls the shutdown with timeout action.
+type shutdownSettings struct {
+	// timeout is split between waiting for the ACPI and the guest agent
+	// shutdown
+	timeout time.Duration
+	// force destroys a domain that didn't shut down in time without asking
+	force bool
+}
+
+var shutdown = shutdownSettings{timeout: time.Minute}
+
+// waitForShutoff polls the domain state until it is shut off or the timeout
+// passes and returns whether it shut off. A transient domain is gone once it
+// shut off.
+func waitForShutoff(dom *libvirt.Domain, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		state, _, err := dom.GetState()
+		if libvirtErr, ok := err.(libvirt.Error); ok && libvirtErr.Code == libvirt.ERR_NO_DOMAIN {
+			return true
+		}
+		if err != nil {
+			log.Println("Failed to get domain state:", err)
+		} else if state == libvirt.DOMAIN_SHUTOFF {
+			return true
+		}
+		time.Sleep(time.Second)
+	}
+	return false
+}
+
+// shutdownWithTimeout asks the guest to shut down through ACPI and then the
+// guest agent, and destroys it if it is still running after the timeout.
+// Unless destroying is forced, the job ends and the user is asked whether to
+// queue a destroy job, so no worker waits for the answer. Every phase is
+// reported in the status bar.
+func shutdownWithTimeout(dom *libvirt.Domain, app *tview.Application, pages *tview.Pages, jobs *jobQueue) error {
+	name, err := dom.GetName()
+	if err != nil {
+		return err
+	}
+	report := func(status string) {
+		log.Println(status)
+		app.QueueUpdateDraw(func() {
+			setStatus(status)
+		})
+	}
+	phaseTimeout := shutdown.timeout / 2
+
+	report("Sending ACPI shutdown to " + name + ", waiting " + phaseTimeout.String())
+	if err := dom.ShutdownFlags(libvirt.DOMAIN_SHUTDOWN_ACPI_POWER_BTN); err != nil {
+		report("ACPI shutdown of " + name + " failed: " + libvirtError(err))
+	}
+	if waitForShutoff(dom, phaseTimeout) {
+		return nil
+	}
+
+	report(name + " ignored ACPI, trying guest agent shutdown, waiting " + phaseTimeout.String())
+	if err := dom.ShutdownFlags(libvirt.DOMAIN_SHUTDOWN_GUEST_AGENT); err != nil {
+		report("Guest agent shutdown of " + name + " failed: " + libvirtError(err))
+	}
+	if waitForShutoff(dom, phaseTimeout) {
+		return nil
+	}
+
+	if shutdown.force {
+		report(name + " is still running after " + shutdown.timeout.String() + ", destroying it")
+		return dom.Destroy()
+	}
+
+	// the job frees dom once it returns, the destroy job gets its own
+	// reference
+	if err := dom.Ref(); err != nil {
+		return err
+	}
+	destroy := newDestroyAction()
+	app.QueueUpdateDraw(func() {
+		confirmAction(pages, destroy, []string{name}, func() {
+			setStatus(destroy.StartMessage() + " " + name)
+			jobs.submit(destroy, dom, name, func(err error) {
+				if err != nil {
+					setStatus(destroy.FailMessage() + " " + name + ". " + libvirtError(err))
+				} else {
+					setStatus("Successfully " + destroy.SuccessMessage() + " " + name)
+				}
+			})
+		}, func() {
+			dom.Free()
+		})
+	})
+	return errors.New("still running after " + shutdown.timeout.String())
+}
@@ -0,0 +1,335 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/beevik/etree"
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+	"libvirt.org/go/libvirt"
+)
+
+type snapshotInfo struct {
+	name        string
+	parent      string
+	description string
+	state       string
+	created     time.Time
+	current     bool
+}
+
+func parseSnapshotXML(xmlDesc string) (snapshotInfo, error) {
+	doc := etree.NewDocument()
+	if err := doc.ReadFromString(xmlDesc); err != nil {
+		return snapshotInfo{}, fmt.Errorf("failed to parse XML: %w", err)
+	}
+	var info snapshotInfo
+	if name := doc.FindElement("/domainsnapshot/name"); name != nil {
+		info.name = name.Text()
+	}
+	if parent := doc.FindElement("/domainsnapshot/parent/name"); parent != nil {
+		info.parent = parent.Text()
+	}
+	if description := doc.FindElement("/domainsnapshot/description"); description != nil {
+		info.description = description.Text()
+	}
+	if state := doc.FindElement("/domainsnapshot/state"); state != nil {
+		info.state = state.Text()
+	}
+	if created := doc.FindElement("/domainsnapshot/creationTime"); created != nil {
+		if seconds, err := strconv.ParseInt(created.Text(), 10, 64); err == nil {
+			info.created = time.Unix(seconds, 0)
+		}
+	}
+	return info, nil
+}
+
+// listSnapshots returns every snapshot of the domain, oldest first.
+func listSnapshots(dom *libvirt.Domain) ([]snapshotInfo, error) {
+	snapshots, err := dom.ListAllSnapshots(0)
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]snapshotInfo, 0, len(snapshots))
+	for _, snapshot := range snapshots {
+		xmlDesc, err := snapshot.GetXMLDesc(0)
+		if err != nil {
+			log.Println("Failed to get snapshot XML description:", err)
+			snapshot.Free()
+			continue
+		}
+		info, err := parseSnapshotXML(xmlDesc)
+		if err != nil {
+			log.Println("Failed to parse snapshot XML:", err)
+			snapshot.Free()
+			continue
+		}
+		if info.current, err = snapshot.IsCurrent(0); err != nil {
+			log.Println("Failed to check current snapshot:", err)
+		}
+		snapshot.Free()
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].created.Before(infos[j].created)
+	})
+	return infos, nil
+}
+
+// snapshotXML returns the description of a new snapshot.
+func snapshotXML(name, description string) (string, error) {
+	doc := etree.NewDocument()
+	snapshot := doc.CreateElement("domainsnapshot")
+	snapshot.CreateElement("name").SetText(name)
+	if description != "" {
+		snapshot.CreateElement("description").SetText(description)
+	}
+	return doc.WriteToString()
+}
+
+// createSnapshot takes a snapshot of the domain. Without diskOnly the memory
+// of a running domain is saved as well.
+func createSnapshot(dom *libvirt.Domain, name, description string, diskOnly bool) error {
+	xmlDesc, err := snapshotXML(name, description)
+	if err != nil {
+		return err
+	}
+	var flags libvirt.DomainSnapshotCreateFlags
+	if diskOnly {
+		flags |= libvirt.DOMAIN_SNAPSHOT_CREATE_DISK_ONLY | libvirt.DOMAIN_SNAPSHOT_CREATE_ATOMIC
+	}
+	snapshot, err := dom.CreateSnapshotXML(xmlDesc, flags)
+	if err != nil {
+		return err
+	}
+	return snapshot.Free()
+}
+
+func revertSnapshot(dom *libvirt.Domain, name string) error {
+	snapshot, err := dom.SnapshotLookupByName(name, 0)
+	if err != nil {
+		return err
+	}
+	defer snapshot.Free()
+	return snapshot.RevertToSnapshot(0)
+}
+
+func deleteSnapshot(dom *libvirt.Domain, name string, children bool) error {
+	snapshot, err := dom.SnapshotLookupByName(name, 0)
+	if err != nil {
+		return err
+	}
+	defer snapshot.Free()
+	var flags libvirt.DomainSnapshotDeleteFlags
+	if children {
+		flags = libvirt.DOMAIN_SNAPSHOT_DELETE_CHILDREN
+	}
+	return snapshot.Delete(flags)
+}
+
+func snapshotText(info snapshotInfo) string {
+	text := fmt.Sprintf("%s  %s  %s", info.name, info.created.Format(time.DateTime), info.state)
+	if info.description != "" {
+		text += "  " + info.description
+	}
+	if info.current {
+		text += "  (current)"
+	}
+	return text
+}
+
+// fillSnapshotTree adds the snapshots below root following their parents.
+// Snapshots whose parent is missing are shown at the top level.
+func fillSnapshotTree(root *tview.TreeNode, snapshots []snapshotInfo) {
+	nodes := make(map[string]*tview.TreeNode, len(snapshots))
+	for _, info := range snapshots {
+		node := tview.NewTreeNode(snapshotText(info)).SetReference(info.name)
+		if info.current {
+			node.SetColor(tcell.ColorYellow)
+		}
+		nodes[info.name] = node
+	}
+	for _, info := range snapshots {
+		parent, ok := nodes[info.parent]
+		if !ok {
+			parent = root
+		}
+		parent.AddChild(nodes[info.name])
+	}
+}
+
+func closeSnapshotForm(pages *tview.Pages) {
+	pages.SwitchToPage("Snapshots")
+	pages.RemovePage("SnapshotForm")
+}
+
+// showCreateSnapshotForm asks for the name, description and kind of a new
+// snapshot and queues its creation.
+func showCreateSnapshotForm(pages *tview.Pages, jobs *jobQueue, dom *libvirt.Domain, vmName string, done func(err error)) {
+	form := tview.NewForm()
+	form.
+		AddInputField("Name: ", time.Now().Format("20060102-150405"), 30, nil, nil).
+		AddInputField("Description: ", "", 50, nil, nil).
+		AddDropDown("Type: ", []string{"With memory", "Disk only"}, 0, nil).
+		AddButton("Create", func() {
+			name := form.GetFormItemByLabel("Name: ").(*tview.InputField).GetText()
+			description := form.GetFormItemByLabel("Description: ").(*tview.InputField).GetText()
+			kind, _ := form.GetFormItemByLabel("Type: ").(*tview.DropDown).GetCurrentOption()
+			diskOnly := kind == 1
+			if name == "" {
+				setStatus("The snapshot needs a name")
+				return
+			}
+			action := NewSimpleAction(Meta{label: "Create snapshot"}, "Creating snapshot "+name+" of", "created snapshot "+name+" of", "Failed to create snapshot "+name+" of", func(d *libvirt.Domain) error {
+				return createSnapshot(d, name, description, diskOnly)
+			})
+			closeSnapshotForm(pages)
+			submitDomainJob(jobs, action, dom, vmName, done)
+		}).
+		AddButton("Cancel", func() {
+			closeSnapshotForm(pages)
+		})
+	form.SetBorder(true).SetTitle("Create snapshot of " + vmName).SetTitleAlign(tview.AlignLeft)
+	form.SetCancelFunc(func() {
+		closeSnapshotForm(pages)
+	})
+
+	formGrid := tview.NewGrid().
+		SetRows(0, 1).
+		SetColumns(0).
+		SetBorders(false).
+		AddItem(form, 0, 0, 1, 1, 0, 0, true).
+		AddItem(statusView, 1, 0, 1, 1, 0, 0, false)
+	pages.AddPage("SnapshotForm", formGrid, true, false)
+	pages.SwitchToPage("SnapshotForm")
+}
+
+// createSnapshotsGrid shows the snapshots of the domain as a tree, c creates
+// a snapshot, v reverts to the selected one, d deletes it and D deletes it
+// together with its children. The page frees dom when it is closed.
+func createSnapshotsGrid(app *tview.Application, pages *tview.Pages, jobs *jobQueue, dom *libvirt.Domain) *tview.Grid {
+	vmName, err := dom.GetName()
+	if err != nil {
+		vmName = ""
+	}
+	root := tview.NewTreeNode(vmName).SetSelectable(false)
+	tree := tview.NewTreeView().SetRoot(root)
+	tree.SetBackgroundColor(tcell.ColorDefault)
+	tree.SetBorder(true).SetTitle("Snapshots of " + vmName).SetTitleAlign(tview.AlignLeft)
+
+	// closed is set once the page is gone, lists and jobs finishing later
+	// leave the tree alone then
+	closed := false
+	reload := func() {
+		if closed {
+			return
+		}
+		// the listing keeps its own reference, the page may be closed
+		// before it is done
+		if err := dom.Ref(); err != nil {
+			log.Println("Failed to reference domain:", err)
+			return
+		}
+		go func() {
+			snapshots, err := listSnapshots(dom)
+			dom.Free()
+			app.QueueUpdateDraw(func() {
+				if closed {
+					return
+				}
+				if err != nil {
+					log.Println("Failed to list snapshots:", err)
+					setStatus("Failed to list snapshots: " + libvirtError(err))
+					return
+				}
+				var selected interface{}
+				if node := tree.GetCurrentNode(); node != nil {
+					selected = node.GetReference()
+				}
+				root.ClearChildren()
+				fillSnapshotTree(root, snapshots)
+				tree.SetCurrentNode(nil)
+				root.Walk(func(node, parent *tview.TreeNode) bool {
+					if node != root && (selected == nil || node.GetReference() == selected) {
+						tree.SetCurrentNode(node)
+						return false
+					}
+					return true
+				})
+			})
+		}()
+	}
+	reload()
+	done := func(err error) {
+		reload()
+	}
+
+	keysView := transparentTextView("c: Create  v: Revert  d: Delete  D: Delete with children  q: Back")
+	snapshotsGrid := tview.NewGrid().
+		SetRows(0, 1, 1).
+		SetColumns(0).
+		SetBorders(false).
+		AddItem(tree, 0, 0, 1, 1, 0, 0, true).
+		AddItem(statusView, 1, 0, 1, 1, 0, 0, false).
+		AddItem(keysView, 2, 0, 1, 1, 0, 0, false)
+	snapshotsGrid.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if event.Key() == tcell.KeyEscape || event.Rune() == 'q' {
+			closed = true
+			pages.SwitchToPage("MainTable")
+			pages.RemovePage("Snapshots")
+			dom.Free()
+			return nil
+		}
+		if event.Rune() == 'c' {
+			showCreateSnapshotForm(pages, jobs, dom, vmName, done)
+			return nil
+		}
+
+		var name string
+		if node := tree.GetCurrentNode(); node != nil {
+			name, _ = node.GetReference().(string)
+		}
+		var action Action
+		switch event.Rune() {
+		case 'v':
+			action = NewSimpleAction(Meta{label: "Revert", dangerous: true}, "Reverting to snapshot "+name+" of", "reverted to snapshot "+name+" of", "Failed to revert to snapshot "+name+" of", func(d *libvirt.Domain) error {
+				return revertSnapshot(d, name)
+			})
+		case 'd', 'D':
+			children := event.Rune() == 'D'
+			start := "Deleting snapshot " + name + " of"
+			if children {
+				start = "Deleting snapshot " + name + " and its children of"
+			}
+			action = NewSimpleAction(Meta{label: "Delete snapshot", dangerous: true}, start, "deleted snapshot "+name+" of", "Failed to delete snapshot "+name+" of", func(d *libvirt.Domain) error {
+				return deleteSnapshot(d, name, children)
+			})
+		default:
+			return event
+		}
+		if name == "" {
+			setStatus("No snapshot selected")
+			return nil
+		}
+		confirmAction(pages, action, []string{vmName}, func() {
+			submitDomainJob(jobs, action, dom, vmName, done)
+		}, func() {})
+		return nil
+	})
+	return snapshotsGrid
+}
+
+// showSnapshots opens the snapshots page, which keeps its own reference to
+// dom in case the domain is undefined while the page is open.
+func showSnapshots(dom *libvirt.Domain, app *tview.Application, pages *tview.Pages, jobs *jobQueue) error {
+	if err := dom.Ref(); err != nil {
+		return err
+	}
+	pages.AddPage("Snapshots", createSnapshotsGrid(app, pages, jobs, dom), true, false)
+	pages.SwitchToPage("Snapshots")
+	return nil
+}
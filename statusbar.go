@@ -8,6 +8,9 @@ import (
 
 var statusView *tview.TextView = transparentTextView("")
 
+// statusIndicator is shown in front of every status message until cleared.
+var statusIndicator, statusMessage string
+
 func updateStatusHeight() {
 	_, _, width, _ := statusView.GetInnerRect()
 	text := statusView.GetText(false)
@@ -35,7 +38,21 @@ func updateStatusHeight() {
 
 }
 
-func setStatus(status string) {
-	statusView.SetText(status)
+func renderStatus() {
+	text := statusMessage
+	if statusIndicator != "" {
+		text = "[" + statusIndicator + "] " + text
+	}
+	statusView.SetText(text)
 	updateStatusHeight()
 }
+
+func setStatus(status string) {
+	statusMessage = status
+	renderStatus()
+}
+
+func setStatusIndicator(indicator string) {
+	statusIndicator = indicator
+	renderStatus()
+}
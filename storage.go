@@ -0,0 +1,368 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+
+	"github.com/beevik/etree"
+	"libvirt.org/go/libvirt"
+)
+
+type poolInfo struct {
+	name       string
+	state      libvirt.StoragePoolState
+	capacity   uint64
+	allocation uint64
+	available  uint64
+	autostart  bool
+}
+
+type volumeInfo struct {
+	name       string
+	path       string
+	format     string
+	volType    libvirt.StorageVolType
+	capacity   uint64
+	allocation uint64
+}
+
+func humanPoolState(state libvirt.StoragePoolState) string {
+	switch state {
+	case libvirt.STORAGE_POOL_INACTIVE:
+		return "Inactive"
+	case libvirt.STORAGE_POOL_BUILDING:
+		return "Building"
+	case libvirt.STORAGE_POOL_RUNNING:
+		return "Running"
+	case libvirt.STORAGE_POOL_DEGRADED:
+		return "Degraded"
+	case libvirt.STORAGE_POOL_INACCESSIBLE:
+		return "Inaccessible"
+	default:
+		return "Unknown"
+	}
+}
+
+func humanVolumeType(volType libvirt.StorageVolType) string {
+	switch volType {
+	case libvirt.STORAGE_VOL_FILE:
+		return "file"
+	case libvirt.STORAGE_VOL_BLOCK:
+		return "block"
+	case libvirt.STORAGE_VOL_DIR:
+		return "dir"
+	case libvirt.STORAGE_VOL_NETWORK:
+		return "network"
+	case libvirt.STORAGE_VOL_NETDIR:
+		return "netdir"
+	case libvirt.STORAGE_VOL_PLOOP:
+		return "ploop"
+	default:
+		return "unknown"
+	}
+}
+
+// listPools returns every storage pool of the connection sorted by name.
+func listPools(conn *libvirt.Connect) ([]poolInfo, error) {
+	pools, err := conn.ListAllStoragePools(0)
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]poolInfo, 0, len(pools))
+	for _, pool := range pools {
+		var info poolInfo
+		if info.name, err = pool.GetName(); err != nil {
+			log.Println("Failed to get pool name:", err)
+			pool.Free()
+			continue
+		}
+		if stats, err := pool.GetInfo(); err != nil {
+			log.Println("Failed to get pool info:", err)
+		} else {
+			info.state = stats.State
+			info.capacity = stats.Capacity
+			info.allocation = stats.Allocation
+			info.available = stats.Available
+		}
+		if info.autostart, err = pool.GetAutostart(); err != nil {
+			log.Println("Failed to get pool autostart:", err)
+		}
+		pool.Free()
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].name < infos[j].name
+	})
+	return infos, nil
+}
+
+// volumeFormat returns the format of the volume from its XML, e.g. qcow2.
+func volumeFormat(vol *libvirt.StorageVol) (string, error) {
+	xmlDesc, err := vol.GetXMLDesc(0)
+	if err != nil {
+		return "", err
+	}
+	doc := etree.NewDocument()
+	if err := doc.ReadFromString(xmlDesc); err != nil {
+		return "", fmt.Errorf("failed to parse XML: %w", err)
+	}
+	if format := doc.FindElement("/volume/target/format"); format != nil {
+		return format.SelectAttrValue("type", ""), nil
+	}
+	return "", nil
+}
+
+// listVolumes returns the volumes of the pool sorted by name. The pool has to
+// be running.
+func listVolumes(conn *libvirt.Connect, poolName string) ([]volumeInfo, error) {
+	pool, err := conn.LookupStoragePoolByName(poolName)
+	if err != nil {
+		return nil, err
+	}
+	defer pool.Free()
+	vols, err := pool.ListAllStorageVolumes(0)
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]volumeInfo, 0, len(vols))
+	for _, vol := range vols {
+		var info volumeInfo
+		if info.name, err = vol.GetName(); err != nil {
+			log.Println("Failed to get volume name:", err)
+			vol.Free()
+			continue
+		}
+		if info.path, err = vol.GetPath(); err != nil {
+			log.Println("Failed to get volume path:", err)
+		}
+		if stats, err := vol.GetInfo(); err != nil {
+			log.Println("Failed to get volume info:", err)
+		} else {
+			info.volType = stats.Type
+			info.capacity = stats.Capacity
+			info.allocation = stats.Allocation
+		}
+		if info.format, err = volumeFormat(&vol); err != nil {
+			log.Println("Failed to get volume format:", err)
+		}
+		vol.Free()
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].name < infos[j].name
+	})
+	return infos, nil
+}
+
+// volumeTypeAndFormat returns whether the volume is a file, a block device or
+// on the network and its format, raw unless the volume says otherwise.
+func volumeTypeAndFormat(conn *libvirt.Connect, poolName, volName string) (volType libvirt.StorageVolType, format string, err error) {
+	err = withVolume(conn, poolName, volName, func(pool *libvirt.StoragePool, vol *libvirt.StorageVol) error {
+		info, err := vol.GetInfo()
+		if err != nil {
+			return err
+		}
+		volType = info.Type
+		format, err = volumeFormat(vol)
+		return err
+	})
+	if format == "" {
+		format = "raw"
+	}
+	return volType, format, err
+}
+
+// withPool looks up the pool by name for fn.
+func withPool(conn *libvirt.Connect, poolName string, fn func(pool *libvirt.StoragePool) error) error {
+	pool, err := conn.LookupStoragePoolByName(poolName)
+	if err != nil {
+		return err
+	}
+	defer pool.Free()
+	return fn(pool)
+}
+
+// withVolume looks up the volume by pool and volume name for fn.
+func withVolume(conn *libvirt.Connect, poolName, volName string, fn func(pool *libvirt.StoragePool, vol *libvirt.StorageVol) error) error {
+	return withPool(conn, poolName, func(pool *libvirt.StoragePool) error {
+		vol, err := pool.LookupStorageVolByName(volName)
+		if err != nil {
+			return err
+		}
+		defer vol.Free()
+		return fn(pool, vol)
+	})
+}
+
+// dirPoolXML describes a directory pool.
+func dirPoolXML(name, path string) (string, error) {
+	doc := etree.NewDocument()
+	pool := doc.CreateElement("pool")
+	pool.CreateAttr("type", "dir")
+	pool.CreateElement("name").SetText(name)
+	pool.CreateElement("target").CreateElement("path").SetText(path)
+	return doc.WriteToString()
+}
+
+// defineDirPool defines a directory pool and builds it, which creates the
+// directory if it is missing. Starting a pool doesn't build it, that would
+// format the devices of other pool types.
+func defineDirPool(conn *libvirt.Connect, name, path string) error {
+	xmlDesc, err := dirPoolXML(name, path)
+	if err != nil {
+		return err
+	}
+	pool, err := conn.StoragePoolDefineXML(xmlDesc, 0)
+	if err != nil {
+		return err
+	}
+	defer pool.Free()
+	return pool.Build(0)
+}
+
+// volumeXML describes a new volume of the given capacity and format.
+func volumeXML(name string, capacity uint64, format string) (string, error) {
+	doc := etree.NewDocument()
+	volume := doc.CreateElement("volume")
+	volume.CreateElement("name").SetText(name)
+	capacityElement := volume.CreateElement("capacity")
+	capacityElement.CreateAttr("unit", "bytes")
+	capacityElement.SetText(strconv.FormatUint(capacity, 10))
+	if format != "" {
+		volume.CreateElement("target").CreateElement("format").CreateAttr("type", format)
+	}
+	return doc.WriteToString()
+}
+
+func createVolume(conn *libvirt.Connect, poolName, name string, capacity uint64, format string) error {
+	xmlDesc, err := volumeXML(name, capacity, format)
+	if err != nil {
+		return err
+	}
+	return withPool(conn, poolName, func(pool *libvirt.StoragePool) error {
+		vol, err := pool.StorageVolCreateXML(xmlDesc, 0)
+		if err != nil {
+			return err
+		}
+		return vol.Free()
+	})
+}
+
+func resizeVolume(conn *libvirt.Connect, poolName, volName string, capacity uint64) error {
+	return withVolume(conn, poolName, volName, func(pool *libvirt.StoragePool, vol *libvirt.StorageVol) error {
+		info, err := vol.GetInfo()
+		if err != nil {
+			return err
+		}
+		var flags libvirt.StorageVolResizeFlags
+		if capacity < info.Capacity {
+			flags = libvirt.STORAGE_VOL_RESIZE_SHRINK
+		}
+		return vol.Resize(capacity, flags)
+	})
+}
+
+// cloneVolume copies the volume into a new one in the same pool, keeping its
+// capacity and format.
+func cloneVolume(conn *libvirt.Connect, poolName, volName, cloneName string) error {
+	return withVolume(conn, poolName, volName, func(pool *libvirt.StoragePool, vol *libvirt.StorageVol) error {
+		info, err := vol.GetInfo()
+		if err != nil {
+			return err
+		}
+		format, err := volumeFormat(vol)
+		if err != nil {
+			return err
+		}
+		xmlDesc, err := volumeXML(cloneName, info.Capacity, format)
+		if err != nil {
+			return err
+		}
+		clone, err := pool.StorageVolCreateXMLFrom(xmlDesc, vol, 0)
+		if err != nil {
+			return err
+		}
+		return clone.Free()
+	})
+}
+
+func deleteVolume(conn *libvirt.Connect, poolName, volName string) error {
+	return withVolume(conn, poolName, volName, func(pool *libvirt.StoragePool, vol *libvirt.StorageVol) error {
+		return vol.Delete(0)
+	})
+}
+
+// uploadVolume replaces the content of the volume with the local file. The
+// data goes through the libvirt connection, so this works on remote hosts.
+func uploadVolume(conn *libvirt.Connect, poolName, volName, localPath string) error {
+	file, err := os.Open(localPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	stream, err := conn.NewStream(0)
+	if err != nil {
+		return err
+	}
+	defer stream.Free()
+	return withVolume(conn, poolName, volName, func(pool *libvirt.StoragePool, vol *libvirt.StorageVol) error {
+		if err := vol.Upload(stream, 0, 0, 0); err != nil {
+			return err
+		}
+		err := stream.SendAll(func(stream *libvirt.Stream, nbytes int) ([]byte, error) {
+			buf := make([]byte, nbytes)
+			n, err := file.Read(buf)
+			if errors.Is(err, io.EOF) {
+				return nil, nil
+			}
+			return buf[:n], err
+		})
+		if err != nil {
+			stream.Abort()
+			return err
+		}
+		return stream.Finish()
+	})
+}
+
+// downloadVolume writes the content of the volume to a new local file. The
+// file is removed again if the download fails.
+func downloadVolume(conn *libvirt.Connect, poolName, volName, localPath string) (err error) {
+	file, err := os.OpenFile(localPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			if removeErr := os.Remove(localPath); removeErr != nil {
+				log.Println("Failed to remove partial download:", removeErr)
+			}
+		}
+	}()
+	stream, err := conn.NewStream(0)
+	if err != nil {
+		return err
+	}
+	defer stream.Free()
+	return withVolume(conn, poolName, volName, func(pool *libvirt.StoragePool, vol *libvirt.StorageVol) error {
+		if err := vol.Download(stream, 0, 0, 0); err != nil {
+			return err
+		}
+		err := stream.RecvAll(func(stream *libvirt.Stream, data []byte) (int, error) {
+			return file.Write(data)
+		})
+		if err != nil {
+			stream.Abort()
+			return err
+		}
+		return stream.Finish()
+	})
+}
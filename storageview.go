@@ -0,0 +1,303 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+	"libvirt.org/go/libvirt"
+)
+
+const (
+	poolKeys   = "s: Start  x: Stop  f: Refresh  A: Autostart  n: Define  u: Undefine  Tab: Volumes  q: Back"
+	volumeKeys = "c: Create  z: Resize  l: Clone  U: Upload  w: Download  d: Delete  Tab: Pools  q: Back"
+)
+
+// storageView is the storage page, the pools on top and the volumes of the
+// selected pool below.
+type storageView struct {
+	hostView
+	pools       []poolInfo
+	volumes     []volumeInfo
+	poolTable   *tview.Table
+	volumeTable *tview.Table
+	keysView    *tview.TextView
+	// volumeLoads counts the started volume loads, a load is only shown if
+	// no other one started after it
+	volumeLoads atomic.Int64
+}
+
+func (v *storageView) selectedPool() (poolInfo, bool) {
+	row, _ := v.poolTable.GetSelection()
+	if row < 1 || row > len(v.pools) {
+		return poolInfo{}, false
+	}
+	return v.pools[row-1], true
+}
+
+func (v *storageView) selectedVolume() (volumeInfo, bool) {
+	row, _ := v.volumeTable.GetSelection()
+	if row < 1 || row > len(v.volumes) {
+		return volumeInfo{}, false
+	}
+	return v.volumes[row-1], true
+}
+
+// reload lists the pools again and keeps the selection by name. Selecting
+// the pool loads its volumes.
+func (v *storageView) reload() {
+	v.background(func() func() {
+		pools, err := listPools(v.conn)
+		return func() {
+			if err != nil {
+				log.Println("Failed to list storage pools:", err)
+				setStatus("Failed to list storage pools: " + libvirtError(err))
+			}
+			selected, _ := v.selectedPool()
+			v.pools = pools
+
+			setListHeader(v.poolTable, []string{"Name", "State", "Capacity", "Allocation", "Available", "Autostart"})
+			row := 1
+			for i, pool := range pools {
+				autostart := "no"
+				if pool.autostart {
+					autostart = "yes"
+				}
+				setCellSpaces(v.poolTable, i+1, 0, pool.name)
+				setCellSpaces(v.poolTable, i+1, 1, humanPoolState(pool.state))
+				setCellSpaces(v.poolTable, i+1, 2, humanize.IBytes(pool.capacity))
+				setCellSpaces(v.poolTable, i+1, 3, humanize.IBytes(pool.allocation))
+				setCellSpaces(v.poolTable, i+1, 4, humanize.IBytes(pool.available))
+				setCellSpaces(v.poolTable, i+1, 5, autostart)
+				if pool.name == selected.name {
+					row = i + 1
+				}
+			}
+			v.poolTable.Select(row, 0)
+		}
+	})
+}
+
+// loadVolumes lists the volumes of the selected pool. Only the last of
+// several loads started in a row is shown.
+func (v *storageView) loadVolumes() {
+	selected, _ := v.selectedVolume()
+	v.volumes = nil
+	setListHeader(v.volumeTable, []string{"Name", "Type", "Format", "Capacity", "Allocation", "Path"})
+	gen := v.volumeLoads.Add(1)
+	pool, ok := v.selectedPool()
+	if !ok {
+		return
+	}
+	v.volumeTable.SetTitle("Volumes of " + pool.name)
+	if pool.state != libvirt.STORAGE_POOL_RUNNING {
+		return
+	}
+	v.background(func() func() {
+		time.Sleep(selectionLoadDelay)
+		if v.volumeLoads.Load() != gen {
+			return func() {}
+		}
+		volumes, err := listVolumes(v.conn, pool.name)
+		return func() {
+			if v.volumeLoads.Load() != gen {
+				return
+			}
+			if err != nil {
+				log.Println("Failed to list volumes:", err)
+				setStatus("Failed to list volumes of " + pool.name + ": " + libvirtError(err))
+				return
+			}
+			v.volumes = volumes
+
+			row := 1
+			for i, vol := range volumes {
+				setCellSpaces(v.volumeTable, i+1, 0, vol.name)
+				setCellSpaces(v.volumeTable, i+1, 1, humanVolumeType(vol.volType))
+				setCellSpaces(v.volumeTable, i+1, 2, vol.format)
+				setCellSpaces(v.volumeTable, i+1, 3, humanize.IBytes(vol.capacity))
+				setCellSpaces(v.volumeTable, i+1, 4, humanize.IBytes(vol.allocation))
+				setCellSpaces(v.volumeTable, i+1, 5, vol.path)
+				if vol.name == selected.name {
+					row = i + 1
+				}
+			}
+			v.volumeTable.Select(row, 0)
+		}
+	})
+}
+
+func (v *storageView) handlePoolKeys(event *tcell.EventKey) *tcell.EventKey {
+	if event.Rune() == 'n' {
+		v.showForm("Define directory pool", []string{"Name: ", "Path: "}, []string{"", "/var/lib/libvirt/images/"}, func(values []string) (SimpleAction, string, error) {
+			name, path := values[0], values[1]
+			if name == "" || path == "" {
+				return SimpleAction{}, "", fmt.Errorf("the pool needs a name and a path")
+			}
+			return hostAction("Define pool", "Defining pool", "defined pool", "Failed to define pool", false, func() error {
+				return defineDirPool(v.conn, name, path)
+			}), name, nil
+		})
+		return nil
+	}
+
+	pool, ok := v.selectedPool()
+	if !ok {
+		return event
+	}
+	name := pool.name
+	var action SimpleAction
+	switch event.Rune() {
+	case 's':
+		action = hostAction("Start pool", "Starting pool", "started pool", "Failed to start pool", false, func() error {
+			return withPool(v.conn, name, func(p *libvirt.StoragePool) error {
+				return p.Create(0)
+			})
+		})
+	case 'x':
+		action = hostAction("Stop pool", "Stopping pool", "stopped pool", "Failed to stop pool", true, func() error {
+			return withPool(v.conn, name, (*libvirt.StoragePool).Destroy)
+		})
+	case 'f':
+		action = hostAction("Refresh pool", "Refreshing pool", "refreshed pool", "Failed to refresh pool", false, func() error {
+			return withPool(v.conn, name, func(p *libvirt.StoragePool) error {
+				return p.Refresh(0)
+			})
+		})
+	case 'A':
+		autostart := !pool.autostart
+		action = hostAction("Autostart pool", "Toggling autostart of pool", "toggled autostart of pool", "Failed to toggle autostart of pool", false, func() error {
+			return withPool(v.conn, name, func(p *libvirt.StoragePool) error {
+				return p.SetAutostart(autostart)
+			})
+		})
+	case 'u':
+		action = hostAction("Undefine pool", "Undefining pool", "undefined pool", "Failed to undefine pool", true, func() error {
+			return withPool(v.conn, name, (*libvirt.StoragePool).Undefine)
+		})
+	default:
+		return event
+	}
+	v.submit(action, name)
+	return nil
+}
+
+func (v *storageView) handleVolumeKeys(event *tcell.EventKey) *tcell.EventKey {
+	pool, ok := v.selectedPool()
+	if !ok {
+		return event
+	}
+	poolName := pool.name
+	if event.Rune() == 'c' {
+		v.showForm("Create volume in "+poolName, []string{"Name: ", "Size: ", "Format: "}, []string{"", "10GiB", "qcow2"}, func(values []string) (SimpleAction, string, error) {
+			name, format := values[0], values[2]
+			size, err := humanize.ParseBytes(values[1])
+			if err != nil {
+				return SimpleAction{}, "", fmt.Errorf("invalid size: %w", err)
+			}
+			return hostAction("Create volume", "Creating volume", "created volume", "Failed to create volume", false, func() error {
+				return createVolume(v.conn, poolName, name, size, format)
+			}), name, nil
+		})
+		return nil
+	}
+
+	vol, ok := v.selectedVolume()
+	if !ok {
+		return event
+	}
+	volName := vol.name
+	switch event.Rune() {
+	case 'z':
+		v.showForm("Resize "+volName, []string{"New size: "}, []string{humanize.IBytes(vol.capacity)}, func(values []string) (SimpleAction, string, error) {
+			size, err := humanize.ParseBytes(values[0])
+			if err != nil {
+				return SimpleAction{}, "", fmt.Errorf("invalid size: %w", err)
+			}
+			return hostAction("Resize volume", "Resizing volume", "resized volume", "Failed to resize volume", size < vol.capacity, func() error {
+				return resizeVolume(v.conn, poolName, volName, size)
+			}), volName, nil
+		})
+	case 'l':
+		v.showForm("Clone "+volName, []string{"Name: "}, []string{volName + "-clone"}, func(values []string) (SimpleAction, string, error) {
+			cloneName := values[0]
+			return hostAction("Clone volume", "Cloning volume "+volName+" to", "cloned volume "+volName+" to", "Failed to clone volume "+volName+" to", false, func() error {
+				return cloneVolume(v.conn, poolName, volName, cloneName)
+			}), cloneName, nil
+		})
+	case 'U':
+		v.showForm("Upload to "+volName, []string{"Local file: "}, []string{""}, func(values []string) (SimpleAction, string, error) {
+			localPath := values[0]
+			return hostAction("Upload volume", "Uploading "+localPath+" to volume", "uploaded "+localPath+" to volume", "Failed to upload "+localPath+" to volume", true, func() error {
+				return uploadVolume(v.conn, poolName, volName, localPath)
+			}), volName, nil
+		})
+	case 'w':
+		v.showForm("Download "+volName, []string{"Local file: "}, []string{volName}, func(values []string) (SimpleAction, string, error) {
+			localPath := values[0]
+			return hostAction("Download volume", "Downloading volume", "downloaded volume", "Failed to download volume", false, func() error {
+				return downloadVolume(v.conn, poolName, volName, localPath)
+			}), volName, nil
+		})
+	case 'd':
+		v.submit(hostAction("Delete volume", "Deleting volume", "deleted volume", "Failed to delete volume", true, func() error {
+			return deleteVolume(v.conn, poolName, volName)
+		}), volName)
+	default:
+		return event
+	}
+	return nil
+}
+
+func createStorageGrid(app *tview.Application, pages *tview.Pages, conn *libvirt.Connect, jobs *jobQueue) *tview.Grid {
+	v := &storageView{
+		hostView:    hostView{app: app, pages: pages, conn: conn, jobs: jobs, page: "Storage"},
+		poolTable:   newListTable("Storage pools"),
+		volumeTable: newListTable("Volumes"),
+		keysView:    transparentTextView(poolKeys),
+	}
+	v.hostView.reload = v.reload
+	v.poolTable.SetSelectionChangedFunc(func(row, column int) {
+		v.loadVolumes()
+	})
+	v.reload()
+	v.poolTable.SetInputCapture(v.handlePoolKeys)
+	v.volumeTable.SetInputCapture(v.handleVolumeKeys)
+
+	storageGrid := tview.NewGrid().
+		SetRows(0, 0, 1, 1).
+		SetColumns(0).
+		SetBorders(false).
+		AddItem(v.poolTable, 0, 0, 1, 1, 0, 0, true).
+		AddItem(v.volumeTable, 1, 0, 1, 1, 0, 0, false).
+		AddItem(statusView, 2, 0, 1, 1, 0, 0, false).
+		AddItem(v.keysView, 3, 0, 1, 1, 0, 0, false)
+	storageGrid.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		switch {
+		case event.Key() == tcell.KeyEscape || event.Rune() == 'q':
+			pages.SwitchToPage("MainTable")
+			pages.RemovePage("Storage")
+			return nil
+		case event.Key() == tcell.KeyTab:
+			if v.poolTable.HasFocus() {
+				app.SetFocus(v.volumeTable)
+				v.keysView.SetText(volumeKeys)
+			} else {
+				app.SetFocus(v.poolTable)
+				v.keysView.SetText(poolKeys)
+			}
+			return nil
+		}
+		return event
+	})
+	return storageGrid
+}
+
+func showStorage(app *tview.Application, pages *tview.Pages, conn *libvirt.Connect, jobs *jobQueue) {
+	pages.AddPage("Storage", createStorageGrid(app, pages, conn, jobs), true, false)
+	pages.SwitchToPage("Storage")
+}